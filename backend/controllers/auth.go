@@ -83,3 +83,16 @@ func Login(db *sql.DB) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"token": tokenString})
 	}
 }
+
+// currentUserID returns the authenticated user's ID set by the JWT middleware
+func currentUserID(c *gin.Context) (int, bool) {
+	value, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+	id, ok := value.(float64)
+	if !ok || id <= 0 {
+		return 0, false
+	}
+	return int(id), true
+}
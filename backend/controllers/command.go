@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"net/http"
+
+	"go-react-chat/kalpesh-vala/github.com/internal/commands"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// commandInfo is a command as listed for composer autocomplete
+type commandInfo struct {
+	*commands.Command
+	Usage string `json:"usage"`
+}
+
+// ListCommandsHandler lists the slash commands for autocomplete. With a
+// room_id, only commands the caller may run in that room are listed.
+func ListCommandsHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Query("room_id")
+
+	if roomID != "" {
+		allowed, err := services.CanReadRoom(c, roomID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+			return
+		}
+	}
+
+	available, err := commands.Available(c, roomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list commands"})
+		return
+	}
+	list := make([]commandInfo, 0, len(available))
+	for _, cmd := range available {
+		list = append(list, commandInfo{Command: cmd, Usage: cmd.Usage()})
+	}
+	c.JSON(http.StatusOK, gin.H{"commands": list})
+}
@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"net/http"
+
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetConversations returns the caller's rooms with last message preview and unread count.
+// Archived rooms are only listed with ?archived=true.
+func GetConversations(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	archived := c.Query("archived") == "true"
+	conversations, err := services.GetConversations(c, userID, archived)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversations": conversations,
+		"total_count":   len(conversations),
+	})
+}
+
+// MarkConversationRead moves the caller's read position in a room forward
+func MarkConversationRead(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Param("room_id")
+
+	var req struct {
+		MessageID string `json:"message_id"`
+	}
+	// An empty body marks everything as read
+	_ = c.ShouldBindJSON(&req)
+
+	var messageID *primitive.ObjectID
+	if req.MessageID != "" {
+		id, err := primitive.ObjectIDFromHex(req.MessageID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+			return
+		}
+		messageID = &id
+	}
+
+	member, err := services.MarkRoomRead(c, roomID, userID, messageID)
+	if err == services.ErrReadMessageNotInRoom {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found in this conversation"})
+		return
+	}
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark conversation as read"})
+		return
+	}
+
+	if globalHub != nil && member.LastReadMessageID != nil {
+		globalHub.BroadcastRead(roomID, userID, member.LastReadMessageID.Hex())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room_id":              roomID,
+		"last_read_message_id": member.LastReadMessageID,
+		"unread_count":         member.UnreadCount,
+	})
+}
+
+// UpdateConversationPreferences changes how a room appears in the caller's conversation list
+func UpdateConversationPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Param("room_id")
+
+	var req struct {
+		Archived   *bool  `json:"archived"`
+		MutedUntil *int64 `json:"muted_until"`
+		Favorite   *bool  `json:"favorite"`
+		Position   *int   `json:"position"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// False and zero values are removed rather than stored
+	set, unset := bson.M{}, bson.M{}
+	if req.Archived != nil {
+		if *req.Archived {
+			set["archived"] = true
+		} else {
+			unset["archived"] = ""
+		}
+	}
+	if req.MutedUntil != nil {
+		if *req.MutedUntil < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "muted_until must be a unix timestamp or 0 to unmute"})
+			return
+		}
+		if *req.MutedUntil > 0 {
+			set["muted_until"] = *req.MutedUntil
+		} else {
+			unset["muted_until"] = ""
+		}
+	}
+	if req.Favorite != nil {
+		if *req.Favorite {
+			set["favorite"] = true
+		} else {
+			unset["favorite"] = ""
+		}
+	}
+	if req.Position != nil {
+		if *req.Position < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "position must be 0 or greater"})
+			return
+		}
+		if *req.Position > 0 {
+			set["position"] = *req.Position
+		} else {
+			unset["position"] = ""
+		}
+	}
+	if len(set) == 0 && len(unset) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No changes provided"})
+		return
+	}
+
+	member, err := services.UpdateRoomPreferences(c, roomID, userID, set, unset)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update conversation preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room_id":     roomID,
+		"preferences": member,
+	})
+}
+
+// GetMessageReceiptsHandler lists who has received and read a message
+func GetMessageReceiptsHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	msgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	message, err := services.GetMessageByID(c, msgID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	allowed, err := services.CanReadRoom(c, message.RoomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+
+	receipts, err := services.GetMessageReceipts(c, message)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch receipts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message_id":   receipts.MessageID,
+		"status":       message.Status,
+		"delivered_to": receipts.DeliveredTo,
+		"read_by":      receipts.ReadBy,
+	})
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListDraftsHandler lists the caller's drafts in all rooms, most recently changed first
+func ListDraftsHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	drafts, err := services.ListDrafts(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drafts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"drafts": drafts})
+}
+
+// GetDraftHandler returns the caller's draft for a room
+func GetDraftHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	draft, err := services.GetDraft(c, userID, c.Param("room_id"))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No draft for this room"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch draft"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"draft": draft})
+}
+
+// SaveDraftHandler stores the caller's draft for a room and syncs it to their
+// other devices. Saving an empty draft deletes it.
+func SaveDraftHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Param("room_id")
+
+	var req struct {
+		Content   string `json:"content"`
+		ReplyToID string `json:"reply_to_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	allowed, err := services.CanPostToRoom(c, roomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+
+	if strings.TrimSpace(req.Content) == "" && req.ReplyToID == "" {
+		if _, err := services.DeleteDraft(c, userID, roomID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete draft"})
+			return
+		}
+		if globalHub != nil {
+			globalHub.SyncDraftDeleted(userID, roomID)
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "Draft deleted", "room_id": roomID})
+		return
+	}
+
+	var replyToID *primitive.ObjectID
+	if req.ReplyToID != "" {
+		id, err := primitive.ObjectIDFromHex(req.ReplyToID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reply_to_id"})
+			return
+		}
+		parent, err := services.GetMessageByID(c, id)
+		if err != nil || parent.RoomID != roomID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reply_to_id must be a message in this room"})
+			return
+		}
+		replyToID = &id
+	}
+
+	draft, err := services.SaveDraft(c, userID, roomID, req.Content, replyToID)
+	if err == services.ErrDraftTooLong {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save draft"})
+		return
+	}
+
+	if globalHub != nil {
+		globalHub.SyncDraft(userID, draft)
+	}
+	c.JSON(http.StatusOK, gin.H{"draft": draft})
+}
+
+// DeleteDraftHandler discards the caller's draft for a room
+func DeleteDraftHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Param("room_id")
+
+	deleted, err := services.DeleteDraft(c, userID, roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete draft"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No draft for this room"})
+		return
+	}
+
+	if globalHub != nil {
+		globalHub.SyncDraftDeleted(userID, roomID)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "Draft deleted", "room_id": roomID})
+}
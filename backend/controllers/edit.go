@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"net/http"
+
+	ws "go-react-chat/kalpesh-vala/github.com/internal/websocket"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EditMessageHandler lets the sender change a message's content
+func EditMessageHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	msgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req struct {
+		Message string `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	edited, mentioned, err := services.EditMessage(c, msgID, userID, req.Message)
+	switch err {
+	case nil:
+	case mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	case services.ErrNotMessageSender, services.ErrEditWindowExpired:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case services.ErrMessageDeleted, services.ErrEditConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case services.ErrEmptyMessage, services.ErrMessageNotEditable:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		if _, ok := err.(*services.ContentError); ok {
+			respondContentError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to edit message"})
+		return
+	}
+
+	if globalHub != nil {
+		globalHub.BroadcastEvent(edited.RoomID, ws.NewEditPayload(edited))
+		globalHub.QueueUnfurl(edited)
+		globalHub.NotifyMentioned(edited, mentioned)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "Message edited",
+		"message": edited,
+	})
+}
+
+// GetMessageEditsHandler returns a message's edit history to room admins
+func GetMessageEditsHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	msgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	message, err := services.GetMessageByID(c, msgID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	isAdmin, err := services.IsRoomAdmin(c, message.RoomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only room moderators can view edit history"})
+		return
+	}
+
+	edits, err := services.GetMessageEdits(c, msgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch edit history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message_id": msgID.Hex(),
+		"current":    message.Message,
+		"edits":      edits,
+	})
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadEmojiHandler lets a server admin add a custom emoji from a multipart
+// form with a shortcode field and an image file
+func UploadEmojiHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if !services.IsServerAdmin(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only server admins can upload custom emoji"})
+		return
+	}
+
+	shortcode, err := services.NormalizeShortcode(c.PostForm("shortcode"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	header, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image file is required"})
+		return
+	}
+	if header.Size > services.MaxEmojiImageBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidEmojiImage.Error()})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, services.MaxEmojiImageBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read image"})
+		return
+	}
+
+	emoji := models.CustomEmoji{
+		Shortcode: shortcode,
+		// Trust the bytes rather than the declared content type
+		ContentType: http.DetectContentType(data),
+		Data:        data,
+		CreatedBy:   userID,
+	}
+	switch err := services.CreateCustomEmoji(c, &emoji); err {
+	case nil:
+	case services.ErrInvalidEmojiImage:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case services.ErrShortcodeTaken:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save emoji"})
+		return
+	}
+
+	emoji.URL = services.EmojiImageURL(emoji.Shortcode)
+	c.JSON(http.StatusCreated, emoji)
+}
+
+// ListEmojiHandler returns every custom emoji with the current version. The
+// version is also sent as the ETag, so clients can revalidate with If-None-Match.
+func ListEmojiHandler(c *gin.Context) {
+	emoji, version, err := services.ListCustomEmoji(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch custom emoji"})
+		return
+	}
+
+	etag := `"` + strconv.FormatInt(version, 10) + `"`
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	for i := range emoji {
+		emoji[i].URL = services.EmojiImageURL(emoji[i].Shortcode)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"version": version,
+		"emoji":   emoji,
+	})
+}
+
+// GetEmojiImageHandler serves a custom emoji's image
+func GetEmojiImageHandler(c *gin.Context) {
+	emoji, err := services.GetCustomEmoji(c, c.Param("shortcode"))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Emoji not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch emoji"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, emoji.ContentType, emoji.Data)
+}
+
+// DeleteEmojiHandler lets a server admin remove a custom emoji. Existing
+// reactions with it are kept and shown as the plain shortcode.
+func DeleteEmojiHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if !services.IsServerAdmin(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only server admins can delete custom emoji"})
+		return
+	}
+
+	shortcode, err := services.NormalizeShortcode(c.Param("shortcode"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err = services.DeleteCustomEmoji(c, shortcode)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Emoji not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete emoji"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "Emoji deleted"})
+}
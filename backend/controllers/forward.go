@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForwardMessageHandler copies a message into one or more rooms on behalf of the caller
+func ForwardMessageHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		MessageID string   `json:"message_id"`
+		RoomIDs   []string `json:"room_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	msgID, err := primitive.ObjectIDFromHex(req.MessageID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	// Drop blanks and duplicates while keeping the caller's order
+	seen := make(map[string]bool)
+	var targets []string
+	for _, roomID := range req.RoomIDs {
+		roomID = strings.TrimSpace(roomID)
+		if roomID != "" && !seen[roomID] {
+			seen[roomID] = true
+			targets = append(targets, roomID)
+		}
+	}
+	if len(targets) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "room_ids is required"})
+		return
+	}
+	if len(targets) > services.MaxForwardTargets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A message can be forwarded to at most 10 rooms at once"})
+		return
+	}
+
+	source, err := services.GetMessageByID(c, msgID)
+	if err != nil || source.Deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if err := services.CheckForwardable(source); err == services.ErrMessageNotForwardable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	allowed, err := services.CanReadRoom(c, source.RoomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot read the source message"})
+		return
+	}
+
+	// Check access to every target before sending anything
+	for _, roomID := range targets {
+		allowed, err := services.CanPostToRoom(c, roomID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room", "room_id": roomID})
+			return
+		}
+	}
+
+	// The posting policy is checked as each copy is sent, since sending one
+	// takes the caller's slow mode slot in that room
+	forwarded := make([]*models.Message, 0, len(targets))
+	for _, roomID := range targets {
+		if err := services.EnforcePostingPolicy(c, roomID, userID, source.AttachmentURL != ""); err != nil {
+			status, response := postingErrorResponse(c, err)
+			response["room_id"] = roomID
+			response["forwarded"] = forwarded
+			c.JSON(status, response)
+			return
+		}
+		msg, err := services.ForwardMessage(c, source, userID, roomID)
+		if err != nil {
+			services.ReleasePostingSlot(roomID, userID)
+		}
+		if contentErr, ok := err.(*services.ContentError); ok {
+			// The source predates a lower limit
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     contentErr.Message,
+				"code":      contentErr.Code,
+				"room_id":   roomID,
+				"forwarded": forwarded,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Failed to forward message",
+				"room_id":   roomID,
+				"forwarded": forwarded,
+			})
+			return
+		}
+		forwarded = append(forwarded, msg)
+
+		if globalHub != nil {
+			globalHub.BroadcastMessage(msg)
+			globalHub.NotifyRoomMembers(msg)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "Message forwarded",
+		"forwarded": forwarded,
+	})
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"net/http"
+
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMentionsHandler lists the caller's unread mentions, newest first. Mentions
+// are cleared by marking the conversation read past the mentioning message.
+func GetMentionsHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	page, limit := parsePagination(c, 20, 100)
+
+	mentions, total, err := services.GetUnreadMentions(c, userID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mentions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mentions":    mentions,
+		"page":        page,
+		"limit":       limit,
+		"total_count": total,
+		"has_more":    int64(page*limit) < total,
+	})
+}
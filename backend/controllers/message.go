@@ -3,13 +3,18 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"go-react-chat/kalpesh-vala/github.com/internal/commands"
 	ws "go-react-chat/kalpesh-vala/github.com/internal/websocket"
 	"go-react-chat/kalpesh-vala/github.com/models"
 	"go-react-chat/kalpesh-vala/github.com/services"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,90 +27,292 @@ func SetGlobalHub(hub *ws.Hub) {
 	globalHub = hub
 }
 
-// SendMessage handles sending a new message
+// SendMessage handles sending a new message. Only the fields a sender chooses
+// are read from the request; everything else on the message is set by the server.
 func SendMessage(c *gin.Context) {
-	var msg models.Message
-	if err := c.ShouldBindJSON(&msg); err != nil {
-		println("JSON binding error:", err.Error())
+	limitBody(c)
+	var req struct {
+		RoomID         string              `json:"room_id"`
+		SenderID       int                 `json:"sender_id"`
+		ClientMsgID    string              `json:"client_msg_id"`
+		Message        string              `json:"message"`
+		AttachmentURL  string              `json:"attachment_url"`
+		AttachmentType string              `json:"attachment_type"`
+		ReplyToID      *primitive.ObjectID `json:"reply_to_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if respondBodyTooLarge(c, err) {
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Add debugging to see what was received
-	println("Received message via REST API:")
-	println("  RoomID:", msg.RoomID)
-	println("  SenderID:", msg.SenderID)
-	println("  Message:", msg.Message)
-	println("  IsGroup:", msg.IsGroup)
-	println("  Status:", msg.Status)
+	_, isDirect := services.PrivateRoomParticipants(req.RoomID)
+	msg := models.Message{
+		RoomID:         req.RoomID,
+		SenderID:       req.SenderID,
+		ClientMsgID:    req.ClientMsgID,
+		Message:        req.Message,
+		IsGroup:        !isDirect,
+		Status:         models.MessageStatusSent, // only moves forward through delivery receipts
+		AttachmentURL:  req.AttachmentURL,
+		AttachmentType: req.AttachmentType,
+		ReplyToID:      req.ReplyToID,
+	}
 
 	// Validate required fields
 	if msg.RoomID == "" {
-		println("ERROR: RoomID is empty")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "room_id is required"})
 		return
 	}
 	if msg.SenderID == 0 {
-		println("ERROR: SenderID is zero")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "sender_id is required and must be greater than 0"})
 		return
 	}
+	if callerID, ok := currentUserID(c); !ok || callerID != msg.SenderID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "sender_id does not match the authenticated user"})
+		return
+	}
+	allowed, err := services.CanPostToRoom(c, msg.RoomID, msg.SenderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+	// Slash commands run instead of being stored
+	if commands.IsCommand(msg.Message) && msg.AttachmentURL == "" {
+		runCommand(c, msg.RoomID, msg.SenderID, msg.Message)
+		return
+	}
+	msg.Message = commands.Unescape(msg.Message)
+
+	// A resend of a message that was already stored gets the original back
+	if msg.ClientMsgID != "" {
+		if err := services.ValidateClientMsgID(msg.ClientMsgID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		stored, err := services.FindClientMessage(c, msg.SenderID, msg.RoomID, msg.ClientMsgID)
+		switch err {
+		case nil:
+			respondStoredMessage(c, stored, true)
+			return
+		case mongo.ErrNoDocuments:
+		case services.ErrClientMsgIDInUse:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store message"})
+			return
+		}
+	}
+
 	// Allow empty message if there's an attachment
 	if msg.Message == "" && msg.AttachmentURL == "" {
-		println("ERROR: Both message and attachment are empty")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "either message content or attachment is required"})
 		return
 	}
+	if err := services.ValidateContent(msg.Message, msg.AttachmentURL, msg.AttachmentType); err != nil {
+		respondContentError(c, err)
+		return
+	}
 
-	// Set default values
-	if msg.Status == "" {
-		msg.Status = "sent"
+	if err := services.EnforcePostingPolicy(c, msg.RoomID, msg.SenderID, msg.AttachmentURL != ""); err != nil {
+		respondPostingError(c, err)
+		return
 	}
-	msg.Deleted = false
 
 	// Store message in database
-	if err := services.InsertMessage(context.Background(), &msg); err != nil {
-		println("Database insert error:", err.Error())
+	err = services.InsertMessage(context.Background(), &msg)
+	if err != nil {
+		services.ReleasePostingSlot(msg.RoomID, msg.SenderID)
+	}
+	switch err {
+	case nil:
+	case services.ErrDuplicateMessage:
+		// The original was stored while this resend was being checked
+		respondStoredMessage(c, &msg, true)
+		return
+	case services.ErrInvalidReplyParent, services.ErrInvalidClientMsgID:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		if _, ok := err.(*services.ContentError); ok {
+			respondContentError(c, err)
+			return
+		}
+		log.Println("Failed to store message:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store message"})
 		return
 	}
 
-	println("Message stored successfully with ID:", msg.ID.Hex())
-
 	// Broadcast message to WebSocket clients if hub is available
 	if globalHub != nil {
-		payload := ws.MessagePayload{
-			Type:           "message",
-			MessageID:      msg.ID.Hex(),
-			RoomID:         msg.RoomID,
-			SenderID:       msg.SenderID,
-			Content:        msg.Message,
-			Timestamp:      msg.Timestamp,
-			IsGroup:        msg.IsGroup,
-			AttachmentURL:  msg.AttachmentURL,
-			AttachmentType: msg.AttachmentType,
-		}
+		globalHub.BroadcastMessage(&msg)
+		globalHub.BroadcastThreadUpdate(&msg)
+		globalHub.NotifyRoomMembers(&msg)
+		globalHub.NotifyMentions(&msg)
+		globalHub.ClearDraft(msg.SenderID, msg.RoomID)
+	}
 
-		// Convert to JSON for broadcasting
-		if payloadBytes, err := json.Marshal(payload); err == nil {
-			broadcastPayload := ws.MessagePayload{
-				RoomID:  msg.RoomID,
-				Message: payloadBytes,
+	respondStoredMessage(c, &msg, false)
+}
+
+// respondStoredMessage acknowledges a sent message. A duplicate is a resend
+// answered with the message stored the first time.
+func respondStoredMessage(c *gin.Context, msg *models.Message, duplicate bool) {
+	status := "Message stored"
+	if duplicate {
+		status = "Message already stored"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":        status,
+		"message_id":    msg.ID.Hex(),
+		"client_msg_id": msg.ClientMsgID,
+		"timestamp":     msg.Timestamp,
+		"room_id":       msg.RoomID,
+		"sender_id":     msg.SenderID,
+		"duplicate":     duplicate,
+	})
+}
+
+// runCommand executes a slash command sent through SendMessage and responds
+// with its reply instead of a stored message
+func runCommand(c *gin.Context, roomID string, userID int, content string) {
+	result, err := commands.Execute(c, roomID, userID, content)
+	if err != nil {
+		if cmdErr, ok := err.(*commands.Error); ok {
+			status := http.StatusBadRequest
+			if cmdErr.Code == commands.CodeForbidden {
+				status = http.StatusForbidden
 			}
-			globalHub.Broadcast <- broadcastPayload
+			c.JSON(status, gin.H{"error": cmdErr.Message, "code": cmdErr.Code})
+			return
+		}
+		if _, ok := err.(*services.PolicyError); ok {
+			respondPostingError(c, err)
+			return
 		}
+		if _, ok := err.(*services.ContentError); ok {
+			respondContentError(c, err)
+			return
+		}
+		log.Println("Failed to run command:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run command"})
+		return
 	}
 
+	if globalHub != nil {
+		globalHub.PublishCommandResult(roomID, result)
+		globalHub.ClearDraft(userID, roomID)
+	}
+
+	messageIDs := make([]string, 0, len(result.Messages))
+	for _, msg := range result.Messages {
+		messageIDs = append(messageIDs, msg.ID.Hex())
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"status":     "Message stored",
-		"message_id": msg.ID.Hex(),
-		"timestamp":  msg.Timestamp,
-		"room_id":    msg.RoomID,
-		"sender_id":  msg.SenderID,
+		"status":      "Command executed",
+		"command":     result.Command,
+		"reply":       result.Reply,
+		"message_ids": messageIDs,
+		"room":        result.Room,
+	})
+}
+
+// respondPostingError writes a structured response for a message rejected by room policy
+func respondPostingError(c *gin.Context, err error) {
+	c.JSON(postingErrorResponse(c, err))
+}
+
+// postingErrorResponse builds the status and body for a message rejected by
+// room policy, and sets Retry-After for slow mode
+func postingErrorResponse(c *gin.Context, err error) (int, gin.H) {
+	policyErr, ok := err.(*services.PolicyError)
+	if !ok {
+		return http.StatusInternalServerError, gin.H{"error": "Failed to check room policy"}
+	}
+
+	status := http.StatusForbidden
+	if policyErr.Code == services.PolicySlowMode {
+		status = http.StatusTooManyRequests
+		c.Header("Retry-After", strconv.FormatInt(policyErr.RetryAfter, 10))
+	}
+	return status, gin.H{
+		"error":       policyErr.Message,
+		"code":        policyErr.Code,
+		"retry_after": policyErr.RetryAfter,
+	}
+}
+
+// respondContentError writes a structured response for message content over the server's limits
+func respondContentError(c *gin.Context, err error) {
+	contentErr, ok := err.(*services.ContentError)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check message content"})
+		return
+	}
+	response := gin.H{"error": contentErr.Message, "code": contentErr.Code}
+	if contentErr.Limit > 0 {
+		response["limit"] = contentErr.Limit
+	}
+	c.JSON(http.StatusBadRequest, response)
+}
+
+// limitBody caps the request body at the largest message payload the server accepts
+func limitBody(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.Limits().MaxPayloadBytes)
+}
+
+// respondBodyTooLarge writes a structured response when reading the body
+// failed because it went over the limit set by limitBody
+func respondBodyTooLarge(c *gin.Context, err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return false
+	}
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error": "Request body is too large",
+		"code":  "payload_too_large",
+		"limit": maxBytesErr.Limit,
 	})
+	return true
 }
 
-// GetChatHistory returns all messages for a room
+// parseHistoryQuery reads the history cursor and limit query parameters.
+// It writes the error response itself and returns false when they are invalid.
+func parseHistoryQuery(c *gin.Context) (services.HistoryQuery, bool) {
+	query := services.HistoryQuery{
+		Before: c.Query("before"),
+		After:  c.Query("after"),
+		Around: c.Query("around"),
+	}
+	cursors := 0
+	for _, cursor := range []string{query.Before, query.After, query.Around} {
+		if cursor != "" {
+			cursors++
+		}
+	}
+	if cursors > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use only one of before, after and around"})
+		return query, false
+	}
+	if rawLimit := c.Query("limit"); rawLimit != "" {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return query, false
+		}
+		query.Limit = limit
+	}
+	return query, true
+}
+
+// GetChatHistory returns one page of a room's messages. The before, after and
+// around query parameters take a message ID or unix timestamp; limit sets the page size.
 func GetChatHistory(c *gin.Context) {
 	roomID := c.Query("room_id")
 	if roomID == "" {
@@ -113,30 +320,72 @@ func GetChatHistory(c *gin.Context) {
 		return
 	}
 
-	// Add debugging
-	println("Fetching messages for room_id:", roomID)
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	allowed, err := services.CanReadRoom(c, roomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+
+	query, ok := parseHistoryQuery(c)
+	if !ok {
+		return
+	}
+
+	query.ViewerID = userID
 
-	messages, err := services.GetMessagesByRoomID(context.Background(), roomID)
+	page, err := services.GetMessageHistory(c, roomID, query)
+	if err == services.ErrInvalidCursor {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println("Failed to fetch messages:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
+		return
+	}
+
+	messageIDs := make([]primitive.ObjectID, 0, len(page.Messages))
+	for _, msg := range page.Messages {
+		messageIDs = append(messageIDs, msg.ID)
+	}
+	starredIDs, err := services.StarredMessageIDs(c, userID, messageIDs)
 	if err != nil {
-		println("Error fetching messages:", err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch messages"})
 		return
 	}
 
-	println("Found", len(messages), "messages for room:", roomID)
 	c.JSON(http.StatusOK, gin.H{
-		"messages":    messages,
-		"total_count": len(messages),
-		"room_id":     roomID,
+		"messages":            page.Messages,
+		"total_count":         len(page.Messages),
+		"room_id":             roomID,
+		"prev_cursor":         page.PrevCursor,
+		"next_cursor":         page.NextCursor,
+		"has_more_before":     page.HasMoreBefore,
+		"has_more_after":      page.HasMoreAfter,
+		"starred_message_ids": starredIDs,
 	})
 }
 
 // AddReactionHandler handles adding a reaction to a message
 func AddReactionHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
 	var req struct {
 		MessageID string `json:"message_id"`
 		Emoji     string `json:"emoji"`
-		UserID    string `json:"user_id"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
@@ -154,17 +403,33 @@ func AddReactionHandler(c *gin.Context) {
 		c.JSON(404, gin.H{"error": "Message not found"})
 		return
 	}
+	allowed, err := services.CanReadRoom(c, message.RoomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
 
 	// Set user's reaction (one per user per message) and get previous reaction if any
-	previousEmoji, err := services.SetUserReaction(c, msgID, req.Emoji, req.UserID)
-	if err != nil {
+	previousEmoji, err := services.SetUserReaction(c, msgID, req.Emoji, strconv.Itoa(userID))
+	switch err {
+	case nil:
+	case services.ErrInvalidReaction, services.ErrInvalidReactor:
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	case mongo.ErrNoDocuments:
+		c.JSON(404, gin.H{"error": "Message not found"})
+		return
+	default:
 		c.JSON(500, gin.H{"error": "Failed to set reaction"})
 		return
 	}
 
 	// Broadcast reaction updates via WebSocket if hub is available
 	if globalHub != nil {
-		userID, _ := strconv.Atoi(req.UserID) // Convert string to int
 
 		// If user had a previous reaction, broadcast its removal first
 		if previousEmoji != "" && previousEmoji != req.Emoji {
@@ -212,10 +477,15 @@ func AddReactionHandler(c *gin.Context) {
 
 // RemoveReactionHandler handles removing a reaction from a message
 func RemoveReactionHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
 	var req struct {
 		MessageID string `json:"message_id"`
 		Emoji     string `json:"emoji"`
-		UserID    string `json:"user_id"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
@@ -233,15 +503,28 @@ func RemoveReactionHandler(c *gin.Context) {
 		c.JSON(404, gin.H{"error": "Message not found"})
 		return
 	}
+	allowed, err := services.CanReadRoom(c, message.RoomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
 
-	if err := services.RemoveReaction(c, msgID, req.Emoji, req.UserID); err != nil {
+	removed, err := services.RemoveReaction(c, msgID, req.Emoji, strconv.Itoa(userID))
+	if err == services.ErrInvalidReactor {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to remove reaction"})
 		return
 	}
 
 	// Broadcast reaction removal via WebSocket if hub is available
-	if globalHub != nil {
-		userID, _ := strconv.Atoi(req.UserID) // Convert string to int
+	if globalHub != nil && removed {
 		reactionEvent := map[string]interface{}{
 			"type":       "reaction",
 			"message_id": req.MessageID,
@@ -263,56 +546,154 @@ func RemoveReactionHandler(c *gin.Context) {
 	c.JSON(200, gin.H{"status": "Reaction removed"})
 }
 
-// DeleteMessageHandler handles marking a message as deleted
+// GetReactionSummaryHandler returns per-emoji reaction counts for a message and
+// one page of who reacted, optionally filtered to a single emoji
+func GetReactionSummaryHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	msgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	message, err := services.GetMessageByID(c, msgID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	allowed, err := services.CanReadRoom(c, message.RoomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+
+	page, limit := parsePagination(c, 50, 200)
+	counts, reactors, total := services.GetReactionSummary(message, c.Query("emoji"), page, limit)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message_id":  message.ID.Hex(),
+		"counts":      counts,
+		"users":       reactors,
+		"page":        page,
+		"limit":       limit,
+		"total_count": total,
+		"has_more":    page*limit < total,
+	})
+}
+
+// DeleteMessageHandler deletes a message for everyone, leaving a tombstone,
+// or with "scope": "me" hides it from the caller only. Moderators may delete
+// other people's messages for everyone and give a reason.
 func DeleteMessageHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
 	var req struct {
 		MessageID string `json:"message_id"`
-		RoomID    string `json:"room_id,omitempty"`
+		Scope     string `json:"scope"`
+		Reason    string `json:"reason"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	msgID, err := primitive.ObjectIDFromHex(req.MessageID)
 	if err != nil {
-		c.JSON(400, gin.H{"error": "Invalid message ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+	if req.Scope == "" {
+		req.Scope = services.DeleteForEveryone
+	}
+	if req.Scope != services.DeleteForEveryone && req.Scope != services.DeleteForMe {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be everyone or me"})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len([]rune(req.Reason)) > services.MaxDeleteReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be at most 500 characters"})
 		return
 	}
 
-	// Get the message first to extract room information
 	message, err := services.GetMessageByID(c, msgID)
 	if err != nil {
-		c.JSON(404, gin.H{"error": "Message not found"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
 		return
 	}
-
-	if err := services.DeleteMessage(c, msgID); err != nil {
-		c.JSON(500, gin.H{"error": "Failed to delete message"})
+	allowed, err := services.CanReadRoom(c, message.RoomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
 		return
 	}
 
-	// Broadcast deletion event via WebSocket if hub is available
-	if globalHub != nil {
-		deletionEvent := map[string]interface{}{
-			"type":       "deletion",
+	if req.Scope == services.DeleteForMe {
+		if err := services.DeleteMessageForMe(c, msgID, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+			return
+		}
+		// Hide it on the caller's other devices too
+		if globalHub != nil {
+			globalHub.SendToUsers([]string{strconv.Itoa(userID)}, "", ws.DeletionPayload{
+				Type:      "deletion",
+				Scope:     services.DeleteForMe,
+				MessageID: req.MessageID,
+				RoomID:    message.RoomID,
+				SenderID:  message.SenderID,
+				DeletedBy: userID,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":     "Message deleted for you",
 			"message_id": req.MessageID,
 			"room_id":    message.RoomID,
-			"sender_id":  message.SenderID,
-		}
+		})
+		return
+	}
 
-		if deletionBytes, err := json.Marshal(deletionEvent); err == nil {
-			broadcastPayload := ws.MessagePayload{
-				RoomID:  message.RoomID,
-				Message: deletionBytes,
-			}
-			globalHub.Broadcast <- broadcastPayload
-		}
+	tombstone, err := services.DeleteMessageForEveryone(c, msgID, userID, req.Reason)
+	switch err {
+	case nil:
+	case services.ErrDeleteNotAllowed:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case services.ErrDeleteWindowExpired:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "delete_window_expired"})
+		return
+	case services.ErrMessageDeleted:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+		return
 	}
 
-	c.JSON(200, gin.H{
+	if globalHub != nil {
+		globalHub.BroadcastDeletion(tombstone)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
 		"status":     "Message deleted",
 		"message_id": req.MessageID,
-		"room_id":    message.RoomID,
+		"room_id":    tombstone.RoomID,
+		"message":    tombstone,
 	})
 }
 
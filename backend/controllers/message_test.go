@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getHistory calls GetChatHistory as user 1, who can read private_1_2
+func getHistory(rawQuery string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/messages?"+rawQuery, nil)
+	c.Set("user_id", float64(1))
+	GetChatHistory(c)
+	return w
+}
+
+func TestGetChatHistoryRejectsBadQueries(t *testing.T) {
+	for _, rawQuery := range []string{
+		"room_id=private_1_2&before=1&after=2",
+		"room_id=private_1_2&before=1&around=2",
+		"room_id=private_1_2&after=1&around=2",
+		"room_id=private_1_2&limit=0",
+		"room_id=private_1_2&limit=-5",
+		"room_id=private_1_2&limit=ten",
+		"room_id=private_1_2&before=yesterday",
+		"room_id=private_1_2&around=1.5",
+		"before=1",
+	} {
+		if w := getHistory(rawQuery); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /messages?%s status = %d, want 400: %s", rawQuery, w.Code, w.Body)
+		}
+	}
+}
+
+func TestGetChatHistoryChecksAccess(t *testing.T) {
+	if w := getHistory("room_id=private_2_3"); w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", w.Code)
+	}
+}
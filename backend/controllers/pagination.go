@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parsePagination reads the page and limit query parameters, falling back to
+// page 1 and defaultLimit, and caps the limit at maxLimit
+func parsePagination(c *gin.Context, defaultLimit, maxLimit int) (int, int) {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return page, limit
+}
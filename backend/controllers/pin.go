@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"net/http"
+
+	ws "go-react-chat/kalpesh-vala/github.com/internal/websocket"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadPinTarget resolves the message being pinned or unpinned and checks the caller may do so.
+// It writes the error response itself and returns nil when the request cannot continue.
+func loadPinTarget(c *gin.Context, roomID, rawMessageID string, userID int) *models.Message {
+	msgID, err := primitive.ObjectIDFromHex(rawMessageID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return nil
+	}
+
+	message, err := services.GetMessageByID(c, msgID)
+	if err != nil || message.RoomID != roomID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return nil
+	}
+
+	allowed, err := services.CanPinMessage(c, message, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return nil
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to pin messages in this room"})
+		return nil
+	}
+	return message
+}
+
+// PinMessage pins a message in a room
+func PinMessage(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Param("id")
+
+	var req struct {
+		MessageID string `json:"message_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := loadPinTarget(c, roomID, req.MessageID, userID)
+	if message == nil {
+		return
+	}
+
+	pinned, err := services.PinMessage(c, message.ID, roomID, userID)
+	if err == services.ErrTooManyPins {
+		c.JSON(http.StatusConflict, gin.H{"error": "This room already has the maximum number of pinned messages"})
+		return
+	}
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin message"})
+		return
+	}
+
+	if globalHub != nil {
+		globalHub.BroadcastEvent(roomID, ws.PinPayload{
+			Type:      "pin",
+			MessageID: pinned.ID.Hex(),
+			RoomID:    roomID,
+			UserID:    userID,
+			Action:    "pin",
+			PinnedAt:  pinned.PinnedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "Message pinned",
+		"message": pinned,
+	})
+}
+
+// UnpinMessage removes a pin from a message in a room
+func UnpinMessage(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Param("id")
+
+	message := loadPinTarget(c, roomID, c.Param("message_id"), userID)
+	if message == nil {
+		return
+	}
+
+	err := services.UnpinMessage(c, message.ID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message is not pinned"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpin message"})
+		return
+	}
+
+	if globalHub != nil {
+		globalHub.BroadcastEvent(roomID, ws.PinPayload{
+			Type:      "pin",
+			MessageID: message.ID.Hex(),
+			RoomID:    roomID,
+			UserID:    userID,
+			Action:    "unpin",
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "Message unpinned",
+		"message_id": message.ID.Hex(),
+	})
+}
+
+// GetPinnedMessages lists the pinned messages of a room
+func GetPinnedMessages(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Param("id")
+
+	allowed, err := services.CanReadRoom(c, roomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+
+	messages, err := services.GetPinnedMessages(c, roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pinned messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pins":        messages,
+		"total_count": len(messages),
+		"room_id":     roomID,
+	})
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"net/http"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePollHandler posts a poll message to a room
+func CreatePollHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		RoomID         string   `json:"room_id"`
+		Question       string   `json:"question"`
+		Options        []string `json:"options"`
+		MultipleChoice bool     `json:"multiple_choice"`
+		Anonymous      bool     `json:"anonymous"`
+		ClosesAt       int64    `json:"closes_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RoomID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "room_id is required"})
+		return
+	}
+
+	allowed, err := services.CanPostToRoom(c, req.RoomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+	if err := services.EnforcePostingPolicy(c, req.RoomID, userID, false); err != nil {
+		respondPostingError(c, err)
+		return
+	}
+
+	msg, err := services.CreatePoll(c, services.PollRequest{
+		RoomID:         req.RoomID,
+		CreatorID:      userID,
+		Question:       req.Question,
+		Options:        req.Options,
+		MultipleChoice: req.MultipleChoice,
+		Anonymous:      req.Anonymous,
+		ClosesAt:       req.ClosesAt,
+	})
+	if err != nil {
+		services.ReleasePostingSlot(req.RoomID, userID)
+	}
+	switch err {
+	case nil:
+	case services.ErrPollQuestion, services.ErrPollOptions, services.ErrPollClosesAt:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		if _, ok := err.(*services.ContentError); ok {
+			respondContentError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create poll"})
+		return
+	}
+
+	if globalHub != nil {
+		globalHub.BroadcastMessage(msg)
+		globalHub.NotifyRoomMembers(msg)
+		globalHub.NotifyMentions(msg)
+		globalHub.ClearDraft(msg.SenderID, msg.RoomID)
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": msg})
+}
+
+// VotePollHandler records or changes the caller's vote. An empty option_ids
+// withdraws the vote, as does DELETE on the same path.
+func VotePollHandler(c *gin.Context) {
+	var req struct {
+		OptionIDs []string `json:"option_ids"`
+	}
+	if c.Request.Method != http.MethodDelete {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	updatePoll(c, func(msgID primitive.ObjectID, userID int) (*models.Message, error) {
+		return services.VotePoll(c, msgID, userID, req.OptionIDs)
+	})
+}
+
+// ClosePollHandler stops a poll from accepting votes
+func ClosePollHandler(c *gin.Context) {
+	updatePoll(c, func(msgID primitive.ObjectID, userID int) (*models.Message, error) {
+		return services.ClosePoll(c, msgID, userID)
+	})
+}
+
+// updatePoll runs a poll change for the caller, then broadcasts and returns the new tallies
+func updatePoll(c *gin.Context, change func(msgID primitive.ObjectID, userID int) (*models.Message, error)) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	msgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	msg, err := change(msgID, userID)
+	switch err {
+	case nil:
+	case mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Poll not found"})
+		return
+	case services.ErrNotAPoll, services.ErrInvalidVote:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case services.ErrNotRoomMember, services.ErrNotPollOwner:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case services.ErrPollClosed, services.ErrMessageDeleted:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update poll"})
+		return
+	}
+
+	if globalHub != nil {
+		globalHub.BroadcastPoll(msg)
+	}
+	c.JSON(http.StatusOK, gin.H{"message_id": msg.ID.Hex(), "poll": msg.Poll})
+}
@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSlowModeSeconds caps a room's slow mode interval at six hours
+const maxSlowModeSeconds = 6 * 60 * 60
+
+// Disappearing messages last between one minute and four weeks
+const (
+	minMessageTTLSeconds = 60
+	maxMessageTTLSeconds = 4 * 7 * 24 * 60 * 60
+)
+
+// CreateRoom creates a new group room owned by the caller
+func CreateRoom(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Name       string `json:"name"`
+		Topic      string `json:"topic"`
+		Visibility string `json:"visibility"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if req.Visibility == "" {
+		req.Visibility = models.RoomVisibilityPrivate
+	}
+	if !models.ValidRoomVisibility(req.Visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "visibility must be public, unlisted or private"})
+		return
+	}
+
+	room := models.Room{
+		Name:       req.Name,
+		Topic:      strings.TrimSpace(req.Topic),
+		Visibility: req.Visibility,
+		CreatedBy:  userID,
+	}
+	if err := services.CreateRoom(c, &room); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"room": room})
+}
+
+// GetRoom returns a room's details if the caller may read it
+func GetRoom(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Param("id")
+
+	room, err := services.GetRoom(c, roomID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch room"})
+		return
+	}
+
+	allowed, err := services.CanReadRoom(c, roomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+
+	isMember, _ := services.IsRoomMember(c, roomID, userID)
+	c.JSON(http.StatusOK, gin.H{
+		"room":      room,
+		"is_member": isMember,
+	})
+}
+
+// UpdateRoom lets room admins change the room's name, topic, visibility and posting policy.
+// Direct message participants may only change the message lifetime settings.
+func UpdateRoom(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Param("id")
+
+	var req struct {
+		Name       *string `json:"name"`
+		Topic      *string `json:"topic"`
+		Visibility *string `json:"visibility"`
+		Policy     *struct {
+			SlowModeSeconds     *int  `json:"slow_mode_seconds"`
+			AnnouncementOnly    *bool `json:"announcement_only"`
+			AttachmentsDisabled *bool `json:"attachments_disabled"`
+			SendersCanPin       *bool `json:"senders_can_pin"`
+			EditWindowSeconds   *int  `json:"edit_window_seconds"`
+			MessageTTLSeconds   *int  `json:"message_ttl_seconds"`
+			DeleteWindowSeconds *int  `json:"delete_window_seconds"`
+		} `json:"policy"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if participants, ok := services.PrivateRoomParticipants(roomID); ok {
+		// Either side of a direct message sets how long its messages live;
+		// the rest of the room is fixed
+		if participants[0] != userID && participants[1] != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the participants can change this conversation"})
+			return
+		}
+		p := req.Policy
+		if req.Name != nil || req.Topic != nil || req.Visibility != nil || (p != nil &&
+			(p.SlowModeSeconds != nil || p.AnnouncementOnly != nil || p.AttachmentsDisabled != nil || p.SendersCanPin != nil)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Direct message rooms only allow changes to message_ttl_seconds, edit_window_seconds and delete_window_seconds"})
+			return
+		}
+	} else {
+		isAdmin, err := services.IsRoomAdmin(c, roomID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+			return
+		}
+		if !isAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only room admins can change room settings"})
+			return
+		}
+	}
+
+	changes := bson.M{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+			return
+		}
+		changes["name"] = name
+	}
+	if req.Topic != nil {
+		changes["topic"] = strings.TrimSpace(*req.Topic)
+	}
+	if req.Visibility != nil {
+		if !models.ValidRoomVisibility(*req.Visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "visibility must be public, unlisted or private"})
+			return
+		}
+		changes["visibility"] = *req.Visibility
+	}
+	if req.Policy != nil {
+		if req.Policy.SlowModeSeconds != nil {
+			if *req.Policy.SlowModeSeconds < 0 || *req.Policy.SlowModeSeconds > maxSlowModeSeconds {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "slow_mode_seconds must be between 0 and 21600"})
+				return
+			}
+			changes["policy.slow_mode_seconds"] = *req.Policy.SlowModeSeconds
+		}
+		if req.Policy.AnnouncementOnly != nil {
+			changes["policy.announcement_only"] = *req.Policy.AnnouncementOnly
+		}
+		if req.Policy.AttachmentsDisabled != nil {
+			changes["policy.attachments_disabled"] = *req.Policy.AttachmentsDisabled
+		}
+		if req.Policy.SendersCanPin != nil {
+			changes["policy.senders_can_pin"] = *req.Policy.SendersCanPin
+		}
+		if req.Policy.EditWindowSeconds != nil {
+			if *req.Policy.EditWindowSeconds < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "edit_window_seconds must be 0 or greater"})
+				return
+			}
+			changes["policy.edit_window_seconds"] = *req.Policy.EditWindowSeconds
+		}
+		if req.Policy.DeleteWindowSeconds != nil {
+			if *req.Policy.DeleteWindowSeconds < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "delete_window_seconds must be 0 or greater"})
+				return
+			}
+			changes["policy.delete_window_seconds"] = *req.Policy.DeleteWindowSeconds
+		}
+		if ttl := req.Policy.MessageTTLSeconds; ttl != nil {
+			if *ttl != 0 && (*ttl < minMessageTTLSeconds || *ttl > maxMessageTTLSeconds) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "message_ttl_seconds must be 0 or between 60 and 2419200"})
+				return
+			}
+			changes["policy.message_ttl_seconds"] = *ttl
+		}
+	}
+	if len(changes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No changes provided"})
+		return
+	}
+
+	var previousTTL int
+	if req.Policy != nil && req.Policy.MessageTTLSeconds != nil {
+		current, err := services.GetRoom(c, roomID)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch room"})
+			return
+		}
+		previousTTL = current.Policy.MessageTTLSeconds
+	}
+
+	room, err := services.UpdateRoom(c, roomID, changes)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update room"})
+		return
+	}
+
+	// Let everyone in the room know their messages now expire differently
+	if req.Policy != nil && req.Policy.MessageTTLSeconds != nil && room.Policy.MessageTTLSeconds != previousTTL {
+		notice := services.DescribeMessageTTL(room.Policy.MessageTTLSeconds)
+		msg, err := services.PostSystemMessage(c, roomID, userID, notice)
+		if err != nil {
+			log.Println("Failed to post disappearing messages notice:", err)
+		} else if globalHub != nil {
+			globalHub.BroadcastMessage(msg)
+			globalHub.NotifyRoomMembers(msg)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room": room})
+}
+
+// GetRoomDirectory lists public rooms, optionally filtered by name or topic
+func GetRoomDirectory(c *gin.Context) {
+	page, limit := parsePagination(c, 20, 100)
+	query := strings.TrimSpace(c.Query("q"))
+
+	rooms, total, err := services.ListPublicRooms(c, query, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch room directory"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rooms":       rooms,
+		"page":        page,
+		"limit":       limit,
+		"total_count": total,
+		"has_more":    int64(page*limit) < total,
+	})
+}
+
+// JoinRoom adds the caller to a public or unlisted room
+func JoinRoom(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Param("id")
+
+	room, err := services.JoinRoom(c, roomID, userID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	if err == services.ErrRoomNotJoinable {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This room is private"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join room"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "Joined room",
+		"room":   room,
+	})
+}
+
+// LeaveRoom removes the caller from a room
+func LeaveRoom(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	roomID := c.Param("id")
+
+	err := services.LeaveRoom(c, roomID, userID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+	if err == services.ErrRoomNotJoinable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Direct message rooms cannot be left"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave room"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "Left room",
+		"room_id": roomID,
+	})
+}
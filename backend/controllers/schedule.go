@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"net/http"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScheduleMessageHandler stores a message to be sent by the caller at send_at
+func ScheduleMessageHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		RoomID         string `json:"room_id"`
+		Message        string `json:"message"`
+		AttachmentURL  string `json:"attachment_url"`
+		AttachmentType string `json:"attachment_type"`
+		ReplyToID      string `json:"reply_to_id"`
+		SendAt         int64  `json:"send_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.RoomID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "room_id is required"})
+		return
+	}
+	if req.Message == "" && req.AttachmentURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either message content or attachment is required"})
+		return
+	}
+	if err := services.ValidateContent(req.Message, req.AttachmentURL, req.AttachmentType); err != nil {
+		respondContentError(c, err)
+		return
+	}
+	if err := services.ValidateSendAt(req.SendAt); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sm := models.ScheduledMessage{
+		RoomID:         req.RoomID,
+		SenderID:       userID,
+		Message:        req.Message,
+		AttachmentURL:  req.AttachmentURL,
+		AttachmentType: req.AttachmentType,
+		SendAt:         req.SendAt,
+	}
+	if req.ReplyToID != "" {
+		replyToID, err := primitive.ObjectIDFromHex(req.ReplyToID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reply_to_id"})
+			return
+		}
+		sm.ReplyToID = &replyToID
+	}
+
+	allowed, err := services.CanPostToRoom(c, req.RoomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+
+	if err := services.CreateScheduledMessage(c, &sm); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule message"})
+		return
+	}
+	c.JSON(http.StatusCreated, sm)
+}
+
+// GetScheduledMessagesHandler lists the caller's pending scheduled messages,
+// optionally for a single room
+func GetScheduledMessagesHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	scheduled, err := services.ListScheduledMessages(c, userID, c.Query("room_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduled messages"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scheduled_messages": scheduled})
+}
+
+// UpdateScheduledMessageHandler changes the content or send time of a pending scheduled message
+func UpdateScheduledMessageHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduled message ID"})
+		return
+	}
+
+	var req struct {
+		Message        *string `json:"message"`
+		AttachmentURL  *string `json:"attachment_url"`
+		AttachmentType *string `json:"attachment_type"`
+		SendAt         *int64  `json:"send_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	current, err := services.GetScheduledMessage(c, id)
+	if err == mongo.ErrNoDocuments || (err == nil && current.SenderID != userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduled message"})
+		return
+	}
+
+	changes := bson.M{}
+	content, attachment, attachmentType := current.Message, current.AttachmentURL, current.AttachmentType
+	if req.Message != nil {
+		changes["message"] = *req.Message
+		content = *req.Message
+	}
+	if req.AttachmentURL != nil {
+		changes["attachment_url"] = *req.AttachmentURL
+		attachment = *req.AttachmentURL
+	}
+	if req.AttachmentType != nil {
+		changes["attachment_type"] = *req.AttachmentType
+		attachmentType = *req.AttachmentType
+	}
+	if req.SendAt != nil {
+		if err := services.ValidateSendAt(*req.SendAt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		changes["send_at"] = *req.SendAt
+	}
+	if len(changes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No changes provided"})
+		return
+	}
+	if content == "" && attachment == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either message content or attachment is required"})
+		return
+	}
+	if err := services.ValidateContent(content, attachment, attachmentType); err != nil {
+		respondContentError(c, err)
+		return
+	}
+
+	updated, err := services.UpdateScheduledMessage(c, id, userID, changes)
+	respondScheduledChange(c, updated, err)
+}
+
+// CancelScheduledMessageHandler cancels a pending scheduled message
+func CancelScheduledMessageHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduled message ID"})
+		return
+	}
+
+	cancelled, err := services.CancelScheduledMessage(c, id, userID)
+	respondScheduledChange(c, cancelled, err)
+}
+
+// respondScheduledChange writes the result of changing a scheduled message.
+// Other users' scheduled messages are reported as not found.
+func respondScheduledChange(c *gin.Context, sm *models.ScheduledMessage, err error) {
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, sm)
+	case mongo.ErrNoDocuments, services.ErrNotMessageSender:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled message not found"})
+	case services.ErrScheduledNotPending:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduled message"})
+	}
+}
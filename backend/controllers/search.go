@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchMessagesHandler runs a full-text search over the caller's rooms.
+// Supports room_id, sender_id, from, to (unix timestamps) and has=attachment
+// filters; has:attachment may also be written inside q.
+func SearchMessagesHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	text, hasAttachment := services.ParseSearchText(c.Query("q"))
+	if strings.TrimSpace(text) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	page, limit := parsePagination(c, 20, 100)
+
+	query := services.SearchQuery{
+		Text:          text,
+		RoomID:        c.Query("room_id"),
+		HasAttachment: hasAttachment || c.Query("has") == "attachment",
+		Page:          page,
+		Limit:         limit,
+	}
+	if raw := c.Query("sender_id"); raw != "" {
+		senderID, err := strconv.Atoi(raw)
+		if err != nil || senderID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sender_id"})
+			return
+		}
+		query.SenderID = senderID
+	}
+	for param, dest := range map[string]*int64{"from": &query.From, "to": &query.To} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		ts, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || ts < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " timestamp"})
+			return
+		}
+		*dest = ts
+	}
+
+	results, total, err := services.SearchMessages(c, userID, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":     results,
+		"page":        page,
+		"limit":       limit,
+		"total_count": total,
+		"has_more":    int64(page*limit) < total,
+	})
+}
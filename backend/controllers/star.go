@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"net/http"
+	"slices"
+
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StarMessageHandler bookmarks a message the caller can read. Starring an
+// already starred message succeeds and keeps the original star time.
+func StarMessageHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	msgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	message, err := services.GetMessageByID(c, msgID)
+	if err != nil || message.Deleted || slices.Contains(message.HiddenFor, userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	allowed, err := services.CanReadRoom(c, message.RoomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+
+	star, created, err := services.StarMessage(c, userID, message)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to star message"})
+		return
+	}
+
+	if created && globalHub != nil {
+		globalHub.SyncStar(userID, "star", star)
+	}
+	c.JSON(http.StatusOK, gin.H{"star": star})
+}
+
+// UnstarMessageHandler removes the caller's star from a message. It works even
+// after the message was deleted or the caller lost access to its room.
+func UnstarMessageHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	msgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	star, err := services.UnstarMessage(c, userID, msgID)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message is not starred"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unstar message"})
+		return
+	}
+
+	if globalHub != nil {
+		globalHub.SyncStar(userID, "unstar", star)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Message unstarred"})
+}
+
+// GetStarredMessagesHandler lists the caller's starred messages across rooms,
+// most recently starred first. Deleted messages and rooms the caller can no
+// longer read are left out.
+func GetStarredMessagesHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	page, limit := parsePagination(c, 20, 100)
+
+	starred, total, err := services.GetStarredMessages(c, userID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch starred messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"starred":     starred,
+		"page":        page,
+		"limit":       limit,
+		"total_count": total,
+		"has_more":    int64(page*limit) < total,
+	})
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"net/http"
+
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetThreadHandler returns a message and one page of its replies. It takes the
+// same before, after, around and limit parameters as the room history.
+func GetThreadHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	msgID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	parent, err := services.GetMessageByID(c, msgID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	allowed, err := services.CanReadRoom(c, parent.RoomID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+		return
+	}
+
+	query, ok := parseHistoryQuery(c)
+	if !ok {
+		return
+	}
+
+	query.ViewerID = userID
+
+	page, err := services.GetThreadReplies(c, parent, query)
+	if err == services.ErrInvalidCursor {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch thread"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"parent":          parent,
+		"replies":         page.Messages,
+		"prev_cursor":     page.PrevCursor,
+		"next_cursor":     page.NextCursor,
+		"has_more_before": page.HasMoreBefore,
+		"has_more_after":  page.HasMoreAfter,
+	})
+}
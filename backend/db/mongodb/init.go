@@ -2,11 +2,15 @@ package mongodb
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -61,4 +65,412 @@ func Init() {
 
 	ChatDB = Client.Database(dbName)
 	log.Printf("Connected to MongoDB successfully. Using database: %s", dbName)
+
+	// Create indexes if they don't exist
+	createIndexes()
+
+	// Bring documents written by older versions up to date
+	migrateReactions()
+	redactDeletedMessages()
+	backfillRooms()
+	syncPinCounts()
+}
+
+// expiryGraceSeconds is how long after expires_at the TTL index waits before
+// removing a message itself. The expiry sweeper runs every few seconds and
+// removes it first, together with its pin, mentions, stars and edit history,
+// and tells the room; the index only catches messages it missed for a day.
+const expiryGraceSeconds = 24 * 3600
+
+func createIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Indexes created by older versions expired messages immediately
+	err := ChatDB.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: "messages"},
+		{Key: "index", Value: bson.M{"keyPattern": bson.M{"expires_at": 1}, "expireAfterSeconds": expiryGraceSeconds}},
+	}).Err()
+	if err != nil && !isMissingIndexError(err) {
+		log.Printf("Error updating expires_at index: %v", err)
+	}
+
+	indexes := map[string][]mongo.IndexModel{
+		"messages": {
+			{Keys: bson.D{{Key: "room_id", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}},
+			{
+				Keys:    bson.D{{Key: "reply_to_id", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}},
+				Options: options.Index().SetPartialFilterExpression(bson.M{"reply_to_id": bson.M{"$exists": true}}),
+			},
+			{
+				Keys:    bson.D{{Key: "room_id", Value: 1}, {Key: "pinned_at", Value: -1}},
+				Options: options.Index().SetPartialFilterExpression(bson.M{"pinned": true}),
+			},
+			{Keys: bson.D{{Key: "message", Value: "text"}}},
+			{
+				Keys:    bson.D{{Key: "sender_id", Value: 1}, {Key: "client_msg_id", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"client_msg_id": bson.M{"$exists": true}}),
+			},
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(expiryGraceSeconds),
+			},
+		},
+		"mentions": {
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "read", Value: 1}, {Key: "timestamp", Value: -1}}},
+			{Keys: bson.D{{Key: "room_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "message_id", Value: 1}}},
+		},
+		"scheduled_messages": {
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "send_at", Value: 1}}},
+			{Keys: bson.D{{Key: "sender_id", Value: 1}, {Key: "status", Value: 1}, {Key: "send_at", Value: 1}}},
+		},
+		"custom_emoji": {
+			{
+				Keys:    bson.D{{Key: "shortcode", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+		"drafts": {
+			{
+				Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "room_id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "updated_at", Value: -1}}},
+		},
+		"stars": {
+			{
+				Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "message_id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "starred_at", Value: -1}}},
+			{Keys: bson.D{{Key: "message_id", Value: 1}}},
+		},
+		"message_edits": {
+			{Keys: bson.D{{Key: "message_id", Value: 1}, {Key: "version", Value: 1}}},
+		},
+		"room_members": {
+			{
+				Keys:    bson.D{{Key: "room_id", Value: 1}, {Key: "user_id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		},
+		"rooms": {
+			{Keys: bson.D{{Key: "last_activity", Value: -1}}},
+			{Keys: bson.D{{Key: "visibility", Value: 1}, {Key: "member_count", Value: -1}}},
+		},
+	}
+
+	for collection, models := range indexes {
+		if _, err := ChatDB.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			log.Printf("Error creating indexes on %s: %v", collection, err)
+		} else {
+			log.Printf("Indexes ensured on %s", collection)
+		}
+	}
+}
+
+// isMissingIndexError reports whether a command failed because the
+// collection or index it changes does not exist yet
+func isMissingIndexError(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Code == 26 || cmdErr.Code == 27) // NamespaceNotFound, IndexNotFound
+}
+
+// migrateReactions rewrites reactions stored as {emoji: [user IDs]} into the
+// {user ID: emoji} map used now. A user with several old reactions keeps one.
+func migrateReactions() {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	toUserMap := bson.M{"$arrayToObject": bson.M{"$reduce": bson.M{
+		"input":        bson.M{"$objectToArray": "$reactions"},
+		"initialValue": bson.A{},
+		"in": bson.M{"$concatArrays": bson.A{"$$value", bson.M{"$map": bson.M{
+			"input": "$$this.v",
+			"as":    "user",
+			"in":    bson.M{"k": "$$user", "v": "$$this.k"},
+		}}}},
+	}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"user_reactions": toUserMap}}},
+		{{Key: "$unset", Value: "reactions"}},
+	}
+
+	result, err := ChatDB.Collection("messages").UpdateMany(ctx, bson.M{"reactions": bson.M{"$exists": true}}, update)
+	if err != nil {
+		log.Printf("Error migrating reactions: %v", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Migrated reactions on %d messages", result.ModifiedCount)
+	}
+}
+
+// redactedFields are the fields services.DeleteMessageForEveryone removes from a deleted message
+var redactedFields = []string{
+	"rich", "attachment_url", "attachment_type", "forwarded_from_id", "previews", "poll",
+	"message_type", "mentions", "user_reactions", "pinned", "pinned_by", "pinned_at",
+	"edited_at", "edit_count",
+}
+
+// redactDeletedMessages strips the content older versions left on deleted
+// messages so they match the tombstones written now
+func redactDeletedMessages() {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	leftovers := bson.A{bson.M{"message": bson.M{"$ne": ""}}}
+	unset := bson.M{}
+	for _, field := range redactedFields {
+		leftovers = append(leftovers, bson.M{field: bson.M{"$exists": true}})
+		unset[field] = ""
+	}
+	result, err := ChatDB.Collection("messages").UpdateMany(ctx,
+		bson.M{"deleted": true, "$or": leftovers},
+		bson.M{"$set": bson.M{"message": ""}, "$unset": unset},
+	)
+	if err != nil {
+		log.Printf("Error redacting deleted messages: %v", err)
+		return
+	}
+	if result.ModifiedCount == 0 {
+		return
+	}
+	log.Printf("Redacted %d deleted messages", result.ModifiedCount)
+
+	for _, name := range []string{"message_edits", "mentions", "stars"} {
+		if err := removeRecordsOfDeletedMessages(ctx, name); err != nil {
+			log.Printf("Error removing %s of deleted messages: %v", name, err)
+		}
+	}
+}
+
+// removeRecordsOfDeletedMessages deletes the documents of a collection keyed by
+// message_id whose message has been deleted, a batch at a time
+func removeRecordsOfDeletedMessages(ctx context.Context, name string) error {
+	const batchSize = 1000
+	collection := ChatDB.Collection(name)
+	cur, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "messages",
+			"localField":   "message_id",
+			"foreignField": "_id",
+			"as":           "message",
+		}}},
+		{{Key: "$match", Value: bson.M{"message.deleted": true}}},
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	batch := make([]primitive.ObjectID, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": batch}})
+		batch = batch[:0]
+		return err
+	}
+	for cur.Next(ctx) {
+		var record struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cur.Decode(&record); err != nil {
+			return err
+		}
+		batch = append(batch, record.ID)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// backfillRooms creates the room and membership records for conversations that
+// only exist as messages, from before rooms were tracked. The rooms are private:
+// every sender becomes a member, as do both sides of a direct message. It runs
+// once; the migrations collection records that it did.
+func backfillRooms() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	const name = "backfill_rooms"
+	migrations := ChatDB.Collection("migrations")
+	if err := migrations.FindOne(ctx, bson.M{"_id": name}).Err(); err == nil {
+		return
+	} else if err != mongo.ErrNoDocuments {
+		log.Printf("Error checking room backfill: %v", err)
+		return
+	}
+
+	cur, err := ChatDB.Collection("messages").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$room_id",
+			"is_group":   bson.M{"$last": "$is_group"},
+			"created_at": bson.M{"$first": "$timestamp"},
+			"last_at":    bson.M{"$last": "$timestamp"},
+			"senders":    bson.M{"$addToSet": "$sender_id"},
+		}}},
+	})
+	if err != nil {
+		log.Printf("Error reading rooms to backfill: %v", err)
+		return
+	}
+	var found []struct {
+		RoomID    string `bson:"_id"`
+		IsGroup   bool   `bson:"is_group"`
+		CreatedAt int64  `bson:"created_at"`
+		LastAt    int64  `bson:"last_at"`
+		Senders   []int  `bson:"senders"`
+	}
+	if err := cur.All(ctx, &found); err != nil {
+		log.Printf("Error reading rooms to backfill: %v", err)
+		return
+	}
+
+	rooms := ChatDB.Collection("rooms")
+	members := ChatDB.Collection("room_members")
+	for _, room := range found {
+		memberIDs := room.Senders
+		if a, b, ok := directParticipants(room.RoomID); ok {
+			memberIDs = []int{a, b}
+		}
+
+		// Rooms created with POST /rooms have a creator and keep their settings
+		result, err := rooms.UpdateOne(ctx,
+			bson.M{"_id": room.RoomID},
+			bson.M{"$setOnInsert": bson.M{
+				"is_group":      room.IsGroup,
+				"visibility":    "private",
+				"created_at":    room.CreatedAt,
+				"last_activity": room.LastAt,
+			}},
+			options.Update().SetUpsert(true),
+		)
+		if err == nil && result.UpsertedCount > 0 {
+			err = backfillRoomPreview(ctx, room.RoomID)
+		}
+		for _, userID := range memberIDs {
+			if err != nil {
+				break
+			}
+			_, err = members.UpdateOne(ctx,
+				bson.M{"room_id": room.RoomID, "user_id": userID},
+				bson.M{"$setOnInsert": bson.M{"role": "member", "unread_count": 0, "joined_at": room.CreatedAt}},
+				options.Update().SetUpsert(true),
+			)
+		}
+		var count int64
+		if err == nil {
+			count, err = members.CountDocuments(ctx, bson.M{"room_id": room.RoomID})
+		}
+		if err == nil {
+			_, err = rooms.UpdateOne(ctx, bson.M{"_id": room.RoomID}, bson.M{"$set": bson.M{"member_count": count}})
+		}
+		if err != nil {
+			log.Printf("Error backfilling room %s: %v", room.RoomID, err)
+			return
+		}
+	}
+
+	if _, err := migrations.InsertOne(ctx, bson.M{"_id": name, "ran_at": time.Now().Unix()}); err != nil {
+		log.Printf("Error recording room backfill: %v", err)
+		return
+	}
+	log.Printf("Backfilled %d rooms from message history", len(found))
+}
+
+// syncPinCounts recomputes each room's pinned_count, the slots services.PinMessage
+// reserves against the pin limit, from the messages that are actually pinned
+func syncPinCounts() {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cur, err := ChatDB.Collection("messages").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"pinned": true, "deleted": false}}},
+		{{Key: "$group", Value: bson.M{"_id": "$room_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		log.Printf("Error counting pinned messages: %v", err)
+		return
+	}
+	var counts []struct {
+		RoomID string `bson:"_id"`
+		Count  int    `bson:"count"`
+	}
+	if err := cur.All(ctx, &counts); err != nil {
+		log.Printf("Error counting pinned messages: %v", err)
+		return
+	}
+
+	rooms := ChatDB.Collection("rooms")
+	pinnedRooms := make([]string, 0, len(counts))
+	for _, room := range counts {
+		pinnedRooms = append(pinnedRooms, room.RoomID)
+		if _, err := rooms.UpdateOne(ctx, bson.M{"_id": room.RoomID}, bson.M{"$set": bson.M{"pinned_count": room.Count}}); err != nil {
+			log.Printf("Error syncing pin count of room %s: %v", room.RoomID, err)
+			return
+		}
+	}
+	_, err = rooms.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$nin": pinnedRooms}, "pinned_count": bson.M{"$ne": 0}},
+		bson.M{"$set": bson.M{"pinned_count": 0}},
+	)
+	if err != nil {
+		log.Printf("Error resetting pin counts: %v", err)
+	}
+}
+
+// backfillRoomPreview sets a new room's last message preview the way
+// services.PreviewText builds it
+func backfillRoomPreview(ctx context.Context, roomID string) error {
+	var latest struct {
+		ID            primitive.ObjectID `bson:"_id"`
+		SenderID      int                `bson:"sender_id"`
+		Message       string             `bson:"message"`
+		Timestamp     int64              `bson:"timestamp"`
+		AttachmentURL string             `bson:"attachment_url"`
+	}
+	err := ChatDB.Collection("messages").FindOne(ctx,
+		bson.M{"room_id": roomID, "deleted": false},
+		options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}),
+	).Decode(&latest)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	content := latest.Message
+	if runes := []rune(content); len(runes) > 100 {
+		content = string(runes[:100]) + "…"
+	}
+	_, err = ChatDB.Collection("rooms").UpdateOne(ctx, bson.M{"_id": roomID}, bson.M{"$set": bson.M{"last_message": bson.M{
+		"message_id":     latest.ID,
+		"sender_id":      latest.SenderID,
+		"content":        content,
+		"timestamp":      latest.Timestamp,
+		"has_attachment": latest.AttachmentURL != "",
+	}}})
+	return err
+}
+
+// directParticipants parses a direct message room ID, private_<user>_<user>.
+// It matches services.PrivateRoomParticipants, which this package cannot import.
+func directParticipants(roomID string) (int, int, bool) {
+	var a, b int
+	var rest string
+	n, _ := fmt.Sscanf(roomID, "private_%d_%d%s", &a, &b, &rest)
+	return a, b, n == 2 && a > 0 && b > 0
 }
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"go-react-chat/kalpesh-vala/github.com/models"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 func CreateUser(db *sql.DB, username, email, hashedPassword string) error {
@@ -65,3 +68,34 @@ func GetUserByUsername(db *sql.DB, username string) (*models.User, error) {
 	}
 	return &user, nil
 }
+
+// GetUserIDsByUsernames maps each lowercased username that exists to its user ID.
+// Matching is case insensitive.
+func GetUserIDsByUsernames(db *sql.DB, usernames []string) (map[string]int, error) {
+	ids := make(map[string]int, len(usernames))
+	if len(usernames) == 0 {
+		return ids, nil
+	}
+
+	lowered := make([]string, len(usernames))
+	for i, name := range usernames {
+		lowered[i] = strings.ToLower(name)
+	}
+
+	query := `SELECT id, LOWER(username) FROM users WHERE LOWER(username) = ANY($1)`
+	rows, err := db.Query(query, pq.Array(lowered))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up usernames: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, fmt.Errorf("failed to read user row: %w", err)
+		}
+		ids[username] = id
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,34 @@
+package redis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// linkPreviewKey hashes the URL so long or odd URLs make safe keys
+func linkPreviewKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return "linkpreview:" + hex.EncodeToString(sum[:])
+}
+
+// GetLinkPreview returns the cached preview for a URL as stored by
+// SetLinkPreview. The bool is false when nothing is cached.
+func GetLinkPreview(url string) ([]byte, bool, error) {
+	data, err := Rdb.Get(ctx, linkPreviewKey(url)).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// SetLinkPreview caches the preview for a URL. Failed fetches are cached
+// too, with an empty value, so a broken link is not fetched for every message.
+func SetLinkPreview(url string, data []byte, ttl time.Duration) error {
+	return Rdb.Set(ctx, linkPreviewKey(url), data, ttl).Err()
+}
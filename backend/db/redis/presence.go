@@ -65,6 +65,28 @@ func IsUserOnline(userID string) (bool, error) {
 	return exists == 1, nil
 }
 
+// OnlineUsers reports which of the given users are online, with one MGET
+func OnlineUsers(userIDs []string) (map[string]bool, error) {
+	online := map[string]bool{}
+	if len(userIDs) == 0 {
+		return online, nil
+	}
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = fmt.Sprintf("user:%s", userID)
+	}
+	values, err := Rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		if value != nil {
+			online[userIDs[i]] = true
+		}
+	}
+	return online, nil
+}
+
 // GetUserLastSeen returns the last seen timestamp for a user
 func GetUserLastSeen(userID string) (int64, error) {
 	lastSeenKey := fmt.Sprintf("user:%s:last_seen", userID)
@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+)
+
+// AcquireSlowModeSlot records that a user is posting in a slow-mode room.
+// If the user already posted within the interval it returns false and how long they must wait.
+func AcquireSlowModeSlot(roomID, userID string, interval time.Duration) (bool, time.Duration, error) {
+	key := slowModeKey(roomID, userID)
+
+	ok, err := Rdb.SetNX(ctx, key, time.Now().Unix(), interval).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	if ok {
+		return true, 0, nil
+	}
+
+	wait, err := Rdb.TTL(ctx, key).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return false, wait, nil
+}
+
+// ReleaseSlowModeSlot frees a user's slow mode slot in a room, letting them post again at once
+func ReleaseSlowModeSlot(roomID, userID string) error {
+	return Rdb.Del(ctx, slowModeKey(roomID, userID)).Err()
+}
+
+func slowModeKey(roomID, userID string) string {
+	return fmt.Sprintf("room:%s:slowmode:%s", roomID, userID)
+}
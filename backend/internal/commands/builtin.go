@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-react-chat/kalpesh-vala/github.com/db/postgres"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const shrug = `¯\_(ツ)_/¯`
+
+// muteForever is how far ahead /mute without a duration mutes a room
+const muteForever = 100 * 365 * 24 * time.Hour
+
+func init() {
+	mustRegister(&Command{
+		Name:        "me",
+		Description: "Describe what you are doing, e.g. /me waves",
+		Args:        []Arg{{Name: "action", Type: ArgText, Description: "what you are doing", Required: true, Rest: true}},
+		Run: func(ctx context.Context, inv *Invocation) (*Result, error) {
+			return post(ctx, inv, inv.Args["action"], models.MessageTypeAction)
+		},
+	})
+	mustRegister(&Command{
+		Name:        "shrug",
+		Description: "Send a message followed by " + shrug,
+		Args:        []Arg{{Name: "message", Type: ArgText, Description: "text before the shrug", Rest: true}},
+		Run: func(ctx context.Context, inv *Invocation) (*Result, error) {
+			return post(ctx, inv, strings.TrimSpace(inv.Args["message"]+" "+shrug), "")
+		},
+	})
+	mustRegister(&Command{
+		Name:        "topic",
+		Description: "Change the room topic",
+		Args:        []Arg{{Name: "topic", Type: ArgText, Description: "the new topic", Required: true, Rest: true}},
+		AdminOnly:   true,
+		GroupOnly:   true,
+		Run:         runTopic,
+	})
+	mustRegister(&Command{
+		Name:        "invite",
+		Description: "Add someone to the room",
+		Args:        []Arg{{Name: "user", Type: ArgUser, Description: "the @username to add", Required: true}},
+		GroupOnly:   true,
+		Run:         runInvite,
+	})
+	mustRegister(&Command{
+		Name:        "leave",
+		Description: "Leave the room",
+		GroupOnly:   true,
+		Run:         runLeave,
+	})
+	mustRegister(&Command{
+		Name:        "mute",
+		Description: "Mute notifications from the room, for a while or until you unmute with /mute off",
+		Args:        []Arg{{Name: "duration", Type: ArgDuration, Description: "how long, like 30m, 8h or 2d, or off"}},
+		Run:         runMute,
+	})
+}
+
+// post stores a message from the caller, subject to the room's posting policy
+func post(ctx context.Context, inv *Invocation, content, messageType string) (*Result, error) {
+	if err := services.EnforcePostingPolicy(ctx, inv.RoomID, inv.UserID, false); err != nil {
+		return nil, err
+	}
+	_, isDirect := services.PrivateRoomParticipants(inv.RoomID)
+	msg := &models.Message{
+		RoomID:      inv.RoomID,
+		SenderID:    inv.UserID,
+		Message:     content,
+		IsGroup:     !isDirect,
+		Status:      models.MessageStatusSent,
+		MessageType: messageType,
+	}
+	if err := services.InsertMessage(ctx, msg); err != nil {
+		services.ReleasePostingSlot(inv.RoomID, inv.UserID)
+		return nil, err
+	}
+	return &Result{Messages: []*models.Message{msg}}, nil
+}
+
+func runTopic(ctx context.Context, inv *Invocation) (*Result, error) {
+	topic := inv.Args["topic"]
+	room, err := services.UpdateRoom(ctx, inv.RoomID, bson.M{"topic": topic})
+	if err != nil {
+		return nil, err
+	}
+	notice, err := services.PostSystemMessage(ctx, inv.RoomID, inv.UserID, `Changed the topic to "`+topic+`"`)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Room: room, Messages: []*models.Message{notice}}, nil
+}
+
+func runInvite(ctx context.Context, inv *Invocation) (*Result, error) {
+	username := inv.Args["user"]
+	ids, err := postgres.GetUserIDsByUsernames(postgres.DB, []string{username})
+	if err != nil {
+		return nil, err
+	}
+	userID, ok := ids[strings.ToLower(username)]
+	if !ok {
+		return nil, newError(CodeInvalidArguments, "No user named @"+username)
+	}
+
+	added, err := services.InviteToRoom(ctx, inv.RoomID, inv.UserID, userID)
+	switch err {
+	case nil:
+	case services.ErrInviteNotAllowed, services.ErrNotRoomMember:
+		return nil, newError(CodeForbidden, err.Error())
+	default:
+		return nil, err
+	}
+	if !added {
+		return &Result{Reply: "@" + username + " is already in this room"}, nil
+	}
+
+	// Mentioning the new member lets them know where they were added
+	notice, err := services.PostSystemMessage(ctx, inv.RoomID, inv.UserID, "Added @"+username+" to the room")
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Messages: []*models.Message{notice}}, nil
+}
+
+func runLeave(ctx context.Context, inv *Invocation) (*Result, error) {
+	switch err := services.LeaveRoom(ctx, inv.RoomID, inv.UserID); err {
+	case nil:
+	case mongo.ErrNoDocuments:
+		return nil, newError(CodeForbidden, services.ErrNotRoomMember.Error())
+	default:
+		return nil, err
+	}
+	notice, err := services.PostSystemMessage(ctx, inv.RoomID, inv.UserID, "Left the room")
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Reply: "You left the room", Messages: []*models.Message{notice}}, nil
+}
+
+func runMute(ctx context.Context, inv *Invocation) (*Result, error) {
+	arg := strings.ToLower(inv.Args["duration"])
+	set, unset := bson.M{}, bson.M{}
+	var reply string
+	switch arg {
+	case "off":
+		unset["muted_until"] = ""
+		reply = "Room unmuted"
+	case "":
+		set["muted_until"] = time.Now().Add(muteForever).Unix()
+		reply = "Room muted until you unmute it with /mute off"
+	default:
+		d, ok := parseDuration(arg)
+		if !ok {
+			return nil, newError(CodeInvalidArguments, "Duration must look like 30m, 8h or 2d, or be off")
+		}
+		set["muted_until"] = time.Now().Add(d).Unix()
+		reply = "Room muted for " + arg
+	}
+
+	_, err := services.UpdateRoomPreferences(ctx, inv.RoomID, inv.UserID, set, unset)
+	if err == mongo.ErrNoDocuments {
+		return nil, newError(CodeForbidden, services.ErrNotRoomMember.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Reply: reply}, nil
+}
+
+// parseDuration accepts Go durations like 30m or 8h, plus whole days like 2d
+func parseDuration(s string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		return time.Duration(n) * 24 * time.Hour, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
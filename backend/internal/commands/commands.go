@@ -0,0 +1,286 @@
+// Package commands is the registry of slash commands typed in the composer,
+// such as /me or /topic. Messages whose content starts with "/" are run as
+// commands instead of being stored; "//" escapes a message that should start
+// with a slash. Built-in commands are registered here and bots register
+// their own with Register.
+package commands
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Command error codes
+const (
+	CodeUnknownCommand   = "unknown_command"
+	CodeInvalidArguments = "invalid_arguments"
+	CodeForbidden        = "forbidden"
+	CodeGroupOnly        = "group_only"
+	CodeFailed           = "command_failed"
+)
+
+// Error is a command rejected before or while running. Its message is meant
+// for the user who typed the command.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Argument types
+const (
+	ArgText     = "text"     // any text
+	ArgUser     = "user"     // an @username; the @ is optional
+	ArgDuration = "duration" // like 30m, 8h or 2d
+)
+
+// Arg declares one command argument
+type Arg struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Rest        bool   `json:"rest,omitempty"` // takes the rest of the line; only for the last argument
+}
+
+// Invocation is one use of a command
+type Invocation struct {
+	RoomID string
+	UserID int
+	Name   string
+	Args   map[string]string // parsed arguments by name; optional ones may be missing
+}
+
+// Result is what a command did. The caller shows Reply to the user who ran
+// the command and broadcasts the rest to the room.
+type Result struct {
+	Command  string
+	Reply    string            // shown only to the caller
+	Messages []*models.Message // stored messages to broadcast to the room
+	Room     *models.Room      // the room after its settings changed
+}
+
+// Command is a slash command. Access checks run before Run is called.
+type Command struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Args        []Arg  `json:"args"`
+	AdminOnly   bool   `json:"admin_only"` // only room admins may run it
+	GroupOnly   bool   `json:"group_only"` // not available in direct messages
+	Bot         string `json:"bot,omitempty"`
+
+	Run func(ctx context.Context, inv *Invocation) (*Result, error) `json:"-"`
+}
+
+// Usage renders the command with its arguments, e.g. "/invite <user>"
+func (c *Command) Usage() string {
+	var b strings.Builder
+	b.WriteString("/" + c.Name)
+	for _, arg := range c.Args {
+		if arg.Required {
+			b.WriteString(" <" + arg.Name + ">")
+		} else {
+			b.WriteString(" [" + arg.Name + "]")
+		}
+	}
+	return b.String()
+}
+
+var (
+	// ErrInvalidCommand is returned by Register for a command without a usable name or Run
+	ErrInvalidCommand = errors.New("command needs a lower-case name and a Run function")
+	// ErrCommandExists is returned by Register when the name is taken
+	ErrCommandExists = errors.New("a command with this name is already registered")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+var registry = struct {
+	sync.RWMutex
+	commands map[string]*Command
+}{commands: map[string]*Command{}}
+
+// Register adds a command to the registry. Bots set Command.Bot to their name.
+func Register(cmd *Command) error {
+	if !namePattern.MatchString(cmd.Name) || cmd.Run == nil {
+		return ErrInvalidCommand
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.commands[cmd.Name]; ok {
+		return ErrCommandExists
+	}
+	registry.commands[cmd.Name] = cmd
+	return nil
+}
+
+// mustRegister registers a built-in command
+func mustRegister(cmd *Command) {
+	if err := Register(cmd); err != nil {
+		panic("commands: " + cmd.Name + ": " + err.Error())
+	}
+}
+
+// Lookup returns the command with the given name
+func Lookup(name string) (*Command, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	cmd, ok := registry.commands[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// IsCommand reports whether message content should be run as a command
+func IsCommand(content string) bool {
+	return strings.HasPrefix(content, "/") && !strings.HasPrefix(content, "//") &&
+		len(content) > 1 && content[1] != ' '
+}
+
+// Unescape removes the slash that keeps a message starting with "//" from
+// being run as a command
+func Unescape(content string) string {
+	if strings.HasPrefix(content, "//") {
+		return content[1:]
+	}
+	return content
+}
+
+// Available lists the commands a user may run, sorted by name. With a room
+// ID, commands the user may not run in that room are left out.
+func Available(ctx context.Context, roomID string, userID int) ([]*Command, error) {
+	registry.RLock()
+	all := make([]*Command, 0, len(registry.commands))
+	for _, cmd := range registry.commands {
+		all = append(all, cmd)
+	}
+	registry.RUnlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+
+	if roomID == "" {
+		return all, nil
+	}
+	isGroup, err := isGroupRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	isAdmin, err := services.IsRoomAdmin(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	available := make([]*Command, 0, len(all))
+	for _, cmd := range all {
+		if (cmd.GroupOnly && !isGroup) || (cmd.AdminOnly && !isAdmin) {
+			continue
+		}
+		available = append(available, cmd)
+	}
+	return available, nil
+}
+
+// Execute parses content as a command and runs it for the user in the room.
+// The caller must already have checked that the user may post to the room.
+// Errors are *Error, *services.PolicyError for commands that post a message,
+// or unexpected failures.
+func Execute(ctx context.Context, roomID string, userID int, content string) (*Result, error) {
+	name, rest := strings.TrimPrefix(content, "/"), ""
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+	cmd, ok := Lookup(name)
+	if !ok {
+		return nil, newError(CodeUnknownCommand, "Unknown command /"+name+". Start the message with // to send it as text.")
+	}
+
+	if cmd.GroupOnly {
+		isGroup, err := isGroupRoom(ctx, roomID)
+		if err != nil {
+			return nil, err
+		}
+		if !isGroup {
+			return nil, newError(CodeGroupOnly, "/"+cmd.Name+" only works in group rooms")
+		}
+	}
+	if cmd.AdminOnly {
+		isAdmin, err := services.IsRoomAdmin(ctx, roomID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !isAdmin {
+			return nil, newError(CodeForbidden, "Only room admins can use /"+cmd.Name)
+		}
+	}
+
+	args, err := parseArgs(cmd, rest)
+	if err != nil {
+		return nil, err
+	}
+	result, err := cmd.Run(ctx, &Invocation{RoomID: roomID, UserID: userID, Name: cmd.Name, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = &Result{}
+	}
+	result.Command = cmd.Name
+	return result, nil
+}
+
+// parseArgs splits the text after the command name into its declared arguments
+func parseArgs(cmd *Command, text string) (map[string]string, error) {
+	args := map[string]string{}
+	text = strings.TrimSpace(text)
+	for _, arg := range cmd.Args {
+		var value string
+		if arg.Rest {
+			value, text = text, ""
+		} else {
+			value, text, _ = strings.Cut(text, " ")
+			text = strings.TrimSpace(text)
+		}
+		if value == "" {
+			if arg.Required {
+				return nil, newError(CodeInvalidArguments, "Usage: "+cmd.Usage())
+			}
+			continue
+		}
+		if arg.Type == ArgUser {
+			value = strings.TrimPrefix(value, "@")
+		}
+		args[arg.Name] = value
+	}
+	if text != "" {
+		return nil, newError(CodeInvalidArguments, "Too many arguments. Usage: "+cmd.Usage())
+	}
+	return args, nil
+}
+
+// isGroupRoom reports whether roomID is an existing group room
+func isGroupRoom(ctx context.Context, roomID string) (bool, error) {
+	if _, ok := services.PrivateRoomParticipants(roomID); ok {
+		return false, nil
+	}
+	room, err := services.GetRoom(ctx, roomID)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return room.IsGroup, nil
+}
@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// unregisterAfter removes a command registered by a test once it finishes
+func unregisterAfter(t *testing.T, name string) {
+	t.Cleanup(func() {
+		registry.Lock()
+		delete(registry.commands, name)
+		registry.Unlock()
+	})
+}
+
+func TestIsCommand(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"/me waves", true},
+		{"/shrug", true},
+		{"//not a command", false},
+		{"/ spaced", false},
+		{"/", false},
+		{"hello /me", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsCommand(tt.content); got != tt.want {
+			t.Errorf("IsCommand(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := map[string]string{
+		"//me is text":  "/me is text",
+		"///triple":     "//triple",
+		"/me waves":     "/me waves",
+		"plain message": "plain message",
+	}
+	for content, want := range tests {
+		if got := Unescape(content); got != want {
+			t.Errorf("Unescape(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	cmd := &Command{
+		Name: "give",
+		Args: []Arg{
+			{Name: "user", Type: ArgUser, Required: true},
+			{Name: "duration", Type: ArgDuration},
+			{Name: "note", Type: ArgText, Rest: true},
+		},
+	}
+	tests := []struct {
+		text string
+		want map[string]string
+	}{
+		{" @alice", map[string]string{"user": "alice"}},
+		{"bob 2d", map[string]string{"user": "bob", "duration": "2d"}},
+		{"  @carol   8h  thanks for   the help ", map[string]string{"user": "carol", "duration": "8h", "note": "thanks for   the help"}},
+	}
+	for _, tt := range tests {
+		got, err := parseArgs(cmd, tt.text)
+		if err != nil {
+			t.Errorf("parseArgs(%q) error = %v", tt.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseArgs(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	required := &Command{Name: "invite", Args: []Arg{{Name: "user", Type: ArgUser, Required: true}}}
+	none := &Command{Name: "leave"}
+	tests := []struct {
+		cmd  *Command
+		text string
+	}{
+		{required, ""},
+		{required, "   "},
+		{required, "alice bob"},
+		{none, "extra"},
+	}
+	for _, tt := range tests {
+		_, err := parseArgs(tt.cmd, tt.text)
+		var cmdErr *Error
+		if !errors.As(err, &cmdErr) || cmdErr.Code != CodeInvalidArguments {
+			t.Errorf("parseArgs(/%s %q) error = %v, want %s", tt.cmd.Name, tt.text, err, CodeInvalidArguments)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{"30m", 30 * time.Minute, true},
+		{"8h", 8 * time.Hour, true},
+		{"2d", 48 * time.Hour, true},
+		{"0d", 0, false},
+		{"-1d", 0, false},
+		{"-5m", 0, false},
+		{"0s", 0, false},
+		{"xd", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDuration(tt.s)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	cmd, ok := Lookup("mute")
+	if !ok {
+		t.Fatal("built-in /mute is not registered")
+	}
+	if got := cmd.Usage(); got != "/mute [duration]" {
+		t.Errorf("Usage() = %q", got)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	run := func(ctx context.Context, inv *Invocation) (*Result, error) { return nil, nil }
+	unregisterAfter(t, "test-register")
+	if err := Register(&Command{Name: "test-register", Run: run}); err != nil {
+		t.Fatalf("Register error = %v", err)
+	}
+	if _, ok := Lookup("TEST-REGISTER"); !ok {
+		t.Error("Lookup is not case-insensitive")
+	}
+	if err := Register(&Command{Name: "test-register", Run: run}); err != ErrCommandExists {
+		t.Errorf("duplicate Register error = %v, want ErrCommandExists", err)
+	}
+	if err := Register(&Command{Name: "me", Run: run}); err != ErrCommandExists {
+		t.Errorf("Register over a built-in error = %v, want ErrCommandExists", err)
+	}
+	for _, name := range []string{"", "Upper", "1abc", "has space", "waytoolongcommandnamethatgoesonforever"} {
+		if err := Register(&Command{Name: name, Run: run}); err != ErrInvalidCommand {
+			t.Errorf("Register(%q) error = %v, want ErrInvalidCommand", name, err)
+		}
+	}
+	if err := Register(&Command{Name: "test-norun"}); err != ErrInvalidCommand {
+		t.Errorf("Register without Run error = %v, want ErrInvalidCommand", err)
+	}
+}
+
+func TestAvailableWithoutRoomListsAllSorted(t *testing.T) {
+	all, err := Available(context.Background(), "", 1)
+	if err != nil {
+		t.Fatalf("Available error = %v", err)
+	}
+	names := make([]string, 0, len(all))
+	for _, cmd := range all {
+		names = append(names, cmd.Name)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("commands are not sorted: %v", names)
+	}
+	for _, builtin := range []string{"invite", "leave", "me", "mute", "shrug", "topic"} {
+		if i := sort.SearchStrings(names, builtin); i == len(names) || names[i] != builtin {
+			t.Errorf("built-in /%s is missing from %v", builtin, names)
+		}
+	}
+}
+
+func TestExecuteUnknownCommand(t *testing.T) {
+	_, err := Execute(context.Background(), "private_1_2", 1, "/nosuchcommand hi")
+	var cmdErr *Error
+	if !errors.As(err, &cmdErr) || cmdErr.Code != CodeUnknownCommand {
+		t.Fatalf("Execute error = %v, want %s", err, CodeUnknownCommand)
+	}
+}
+
+func TestExecuteGroupOnlyInDirectMessage(t *testing.T) {
+	// /topic is also admin-only; the room type is checked first
+	for _, content := range []string{"/topic New topic", "/invite @bob", "/leave"} {
+		_, err := Execute(context.Background(), "private_1_2", 1, content)
+		var cmdErr *Error
+		if !errors.As(err, &cmdErr) || cmdErr.Code != CodeGroupOnly {
+			t.Errorf("Execute(%q) error = %v, want %s", content, err, CodeGroupOnly)
+		}
+	}
+}
+
+func TestExecuteRunsWithParsedArgs(t *testing.T) {
+	var got *Invocation
+	unregisterAfter(t, "test-echo")
+	err := Register(&Command{
+		Name: "test-echo",
+		Args: []Arg{{Name: "user", Type: ArgUser, Required: true}, {Name: "text", Type: ArgText, Rest: true}},
+		Run: func(ctx context.Context, inv *Invocation) (*Result, error) {
+			got = inv
+			return &Result{Reply: "ok"}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Register error = %v", err)
+	}
+
+	result, err := Execute(context.Background(), "private_1_2", 1, "/Test-Echo @bob hello there")
+	if err != nil {
+		t.Fatalf("Execute error = %v", err)
+	}
+	if result.Command != "test-echo" || result.Reply != "ok" {
+		t.Errorf("result = %+v", result)
+	}
+	want := &Invocation{
+		RoomID: "private_1_2",
+		UserID: 1,
+		Name:   "test-echo",
+		Args:   map[string]string{"user": "bob", "text": "hello there"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("invocation = %+v, want %+v", got, want)
+	}
+
+	_, err = Execute(context.Background(), "private_1_2", 1, "/test-echo")
+	var cmdErr *Error
+	if !errors.As(err, &cmdErr) || cmdErr.Code != CodeInvalidArguments {
+		t.Errorf("Execute without arguments error = %v, want %s", err, CodeInvalidArguments)
+	}
+}
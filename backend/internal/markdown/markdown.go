@@ -0,0 +1,344 @@
+// Package markdown parses the markdown subset supported in messages into
+// models.RichText: bold, italic, inline code, code blocks, links, quotes,
+// lists, @mentions and :shortcode: emoji. Raw HTML is kept as plain text and links are only
+// kept for safe schemes, so the result is safe to render on any client.
+package markdown
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+)
+
+// maxDepth limits how deeply quotes and emphasis may nest
+const maxDepth = 8
+
+var (
+	fencePattern     = regexp.MustCompile("^```\\s*([A-Za-z0-9_+#.-]*)\\s*$")
+	unorderedPattern = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	orderedPattern   = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+(.*)$`)
+	quotePattern     = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	mentionPattern   = regexp.MustCompile(`^@([A-Za-z0-9_][A-Za-z0-9_.-]*)`)
+	emojiPattern     = regexp.MustCompile(`^:([a-z0-9_+-]{2,32}):`)
+	autolinkPattern  = regexp.MustCompile(`^https?://[^\s<>"]+`)
+)
+
+// safeSchemes are the link schemes kept as links; anything else is shown as text
+var safeSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// Parse converts message content into rich text
+func Parse(text string) *models.RichText {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return &models.RichText{Blocks: parseBlocks(strings.Split(text, "\n"), 0)}
+}
+
+// parseBlocks groups lines into paragraphs, code blocks, quotes and lists
+func parseBlocks(lines []string, depth int) []models.RichBlock {
+	blocks := []models.RichBlock{}
+	var paragraph []string
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			blocks = append(blocks, models.RichBlock{
+				Type:    models.BlockParagraph,
+				Inlines: parseInline(strings.Join(paragraph, "\n"), depth),
+			})
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			flush()
+			var code []string
+			i++
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != "```"; i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, models.RichBlock{
+				Type:     models.BlockCode,
+				Text:     strings.Join(code, "\n"),
+				Language: m[1],
+			})
+			continue
+		}
+
+		if quotePattern.MatchString(line) && depth < maxDepth {
+			flush()
+			var quoted []string
+			for ; i < len(lines); i++ {
+				m := quotePattern.FindStringSubmatch(lines[i])
+				if m == nil {
+					break
+				}
+				quoted = append(quoted, m[1])
+			}
+			i--
+			blocks = append(blocks, models.RichBlock{
+				Type:   models.BlockQuote,
+				Blocks: parseBlocks(quoted, depth+1),
+			})
+			continue
+		}
+
+		if pattern, ordered := listPattern(line); pattern != nil {
+			flush()
+			var items [][]models.RichInline
+			for ; i < len(lines); i++ {
+				m := pattern.FindStringSubmatch(lines[i])
+				if m == nil {
+					break
+				}
+				items = append(items, parseInline(m[1], depth))
+			}
+			i--
+			blocks = append(blocks, models.RichBlock{
+				Type:    models.BlockList,
+				Ordered: ordered,
+				Items:   items,
+			})
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	flush()
+	return blocks
+}
+
+// listPattern returns the pattern of the list item starting the line, if any
+func listPattern(line string) (*regexp.Regexp, bool) {
+	if unorderedPattern.MatchString(line) {
+		return unorderedPattern, false
+	}
+	if orderedPattern.MatchString(line) {
+		return orderedPattern, true
+	}
+	return nil, false
+}
+
+// inlineParser turns one block's text into inline nodes
+type inlineParser struct {
+	src   string
+	nodes []models.RichInline
+	text  strings.Builder
+}
+
+// parseInline parses emphasis, code spans, links, mentions and emoji in text
+func parseInline(src string, depth int) []models.RichInline {
+	p := &inlineParser{src: src}
+	p.parse(depth)
+	return p.nodes
+}
+
+// flushText ends the current run of plain text
+func (p *inlineParser) flushText() {
+	if p.text.Len() > 0 {
+		p.nodes = append(p.nodes, models.RichInline{Type: models.InlineText, Text: p.text.String()})
+		p.text.Reset()
+	}
+}
+
+// add appends a node after any pending plain text
+func (p *inlineParser) add(node models.RichInline) {
+	p.flushText()
+	p.nodes = append(p.nodes, node)
+}
+
+func (p *inlineParser) parse(depth int) {
+	src := p.src
+	for i := 0; i < len(src); {
+		rest := src[i:]
+		prev := lastRune(src[:i])
+
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && isPunct(rest[1]):
+			p.text.WriteByte(rest[1])
+			i += 2
+			continue
+
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				p.add(models.RichInline{Type: models.InlineCode, Text: rest[1 : end+1]})
+				i += end + 2
+				continue
+			}
+
+		case (rest[0] == '*' || rest[0] == '_') && depth < maxDepth:
+			if n, node, ok := emphasis(rest, prev, depth); ok {
+				p.add(node)
+				i += n
+				continue
+			}
+
+		case rest[0] == '[':
+			if n, node, ok := link(rest, depth); ok {
+				p.add(node)
+				i += n
+				continue
+			}
+
+		case rest[0] == '@' && !isWordRune(prev) && prev != '@' && prev != '.':
+			if m := mentionPattern.FindStringSubmatch(rest); m != nil {
+				name := strings.TrimRight(m[1], ".-")
+				p.add(models.RichInline{Type: models.InlineMention, Text: name})
+				i += 1 + len(name)
+				continue
+			}
+
+		case rest[0] == ':' && !isWordRune(prev) && prev != ':':
+			// Whether the shortcode is a custom emoji is left to the caller
+			if m := emojiPattern.FindStringSubmatch(rest); m != nil {
+				p.add(models.RichInline{Type: models.InlineEmoji, Text: m[1]})
+				i += len(m[0])
+				continue
+			}
+
+		case rest[0] == 'h' && !isWordRune(prev):
+			if m := autolinkPattern.FindString(rest); m != "" {
+				target := strings.TrimRight(m, ".,;:!?)'\"")
+				p.add(models.RichInline{
+					Type:     models.InlineLink,
+					URL:      target,
+					Children: []models.RichInline{{Type: models.InlineText, Text: target}},
+				})
+				i += len(target)
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		p.text.WriteString(rest[:size])
+		i += size
+	}
+	p.flushText()
+}
+
+// emphasis parses **bold**, __bold__, *italic* or _italic_ at the start of s.
+// Underscores inside words, as in snake_case, are left alone.
+func emphasis(s string, prev rune, depth int) (int, models.RichInline, bool) {
+	delim := s[:1]
+	nodeType := models.InlineItalic
+	if strings.HasPrefix(s, delim+delim) {
+		delim += delim
+		nodeType = models.InlineBold
+	}
+	if delim[0] == '_' && isWordRune(prev) {
+		return 0, models.RichInline{}, false
+	}
+
+	body := s[len(delim):]
+	if body == "" || unicode.IsSpace(firstRune(body)) {
+		return 0, models.RichInline{}, false
+	}
+	for from := 0; from < len(body); {
+		end := strings.Index(body[from:], delim)
+		if end < 0 {
+			break
+		}
+		end += from
+		// In ***text*** the outer delimiters are bold and the inner ones italic
+		if len(delim) == 2 && strings.HasPrefix(body[end+2:], delim[:1]) {
+			end++
+		}
+		after := body[end+len(delim):]
+		closes := end > 0 && !unicode.IsSpace(lastRune(body[:end]))
+		// A single delimiter must not be half of a double one
+		if closes && len(delim) == 1 && strings.HasPrefix(after, delim) {
+			closes = false
+		}
+		if closes && delim[0] == '_' && isWordRune(firstRune(after)) {
+			closes = false
+		}
+		if closes {
+			return len(delim) + end + len(delim), models.RichInline{
+				Type:     nodeType,
+				Children: parseInline(body[:end], depth+1),
+			}, true
+		}
+		from = end + len(delim)
+	}
+	return 0, models.RichInline{}, false
+}
+
+// link parses [text](url) at the start of s. Links with unsafe schemes, such
+// as javascript:, are kept as their text only.
+func link(s string, depth int) (int, models.RichInline, bool) {
+	closeText := strings.Index(s, "](")
+	if closeText < 1 || strings.ContainsRune(s[1:closeText], '\n') {
+		return 0, models.RichInline{}, false
+	}
+	closeURL := matchingParen(s[closeText+2:])
+	if closeURL < 0 {
+		return 0, models.RichInline{}, false
+	}
+	target := strings.TrimSpace(s[closeText+2 : closeText+2+closeURL])
+	n := closeText + 2 + closeURL + 1
+
+	children := parseInline(s[1:closeText], depth+1)
+	if !SafeURL(target) {
+		return n, models.RichInline{Type: models.InlineText, Text: s[1:closeText]}, true
+	}
+	return n, models.RichInline{Type: models.InlineLink, URL: target, Children: children}, true
+}
+
+// matchingParen finds the ")" closing a link target, allowing balanced
+// parentheses inside it. It returns -1 if the target is not closed on its line.
+func matchingParen(s string) int {
+	open := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			open++
+		case ')':
+			if open == 0 {
+				return i
+			}
+			open--
+		case '\n':
+			return -1
+		}
+	}
+	return -1
+}
+
+// SafeURL reports whether a link target uses a scheme that is safe to follow
+func SafeURL(target string) bool {
+	if target == "" || strings.ContainsAny(target, " \t\n<>\"") {
+		return false
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return safeSchemes[scheme] && (scheme == "mailto" || u.Host != "")
+}
+
+func isPunct(b byte) bool {
+	return b < utf8.RuneSelf && unicode.IsPunct(rune(b)) || strings.IndexByte("`*_[]()@>#+-.!\\", b) >= 0
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
@@ -0,0 +1,152 @@
+package markdown
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+)
+
+func text(s string) models.RichInline {
+	return models.RichInline{Type: models.InlineText, Text: s}
+}
+
+// inlines returns the inline nodes of a message that parses to one paragraph
+func inlines(t *testing.T, src string) []models.RichInline {
+	t.Helper()
+	rich := Parse(src)
+	if len(rich.Blocks) != 1 || rich.Blocks[0].Type != models.BlockParagraph {
+		t.Fatalf("Parse(%q) = %+v, want one paragraph", src, rich.Blocks)
+	}
+	return rich.Blocks[0].Inlines
+}
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/a?b=c", true},
+		{"http://example.com", true},
+		{"HTTPS://example.com", true},
+		{"mailto:someone@example.com", true},
+		{"javascript:alert(1)", false},
+		{"JavaScript:alert(1)", false},
+		{"data:text/html;base64,PHNjcmlwdD4=", false},
+		{"vbscript:msgbox", false},
+		{"file:///etc/passwd", false},
+		{"//example.com", false},
+		{"/relative/path", false},
+		{"https://", false},
+		{"https://example.com/\"onmouseover=\"x", false},
+		{"https://exa mple.com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := SafeURL(tt.url); got != tt.want {
+			t.Errorf("SafeURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestParseUnsafeLinksBecomeText(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []models.RichInline
+	}{
+		{"[click](javascript:alert(1))", []models.RichInline{text("click")}},
+		{"[x](data:text/html,<b>hi</b>)", []models.RichInline{text("x")}},
+		{"[docs](https://example.com/docs)", []models.RichInline{{
+			Type:     models.InlineLink,
+			URL:      "https://example.com/docs",
+			Children: []models.RichInline{text("docs")},
+		}}},
+	}
+	for _, tt := range tests {
+		if got := inlines(t, tt.src); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) inlines = %+v, want %+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseKeepsHTMLAsText(t *testing.T) {
+	src := `<script>alert("x")</script> <img src=x onerror=alert(1)>`
+	got := inlines(t, src)
+	want := []models.RichInline{text(src)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse(%q) inlines = %+v, want %+v", src, got, want)
+	}
+}
+
+func TestParseAutolink(t *testing.T) {
+	got := inlines(t, "see https://example.com/page.")
+	want := []models.RichInline{
+		text("see "),
+		{
+			Type:     models.InlineLink,
+			URL:      "https://example.com/page",
+			Children: []models.RichInline{text("https://example.com/page")},
+		},
+		text("."),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("inlines = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []models.RichInline
+	}{
+		{"**bold**", []models.RichInline{{Type: models.InlineBold, Children: []models.RichInline{text("bold")}}}},
+		{"_italic_", []models.RichInline{{Type: models.InlineItalic, Children: []models.RichInline{text("italic")}}}},
+		{"snake_case_name", []models.RichInline{text("snake_case_name")}},
+		{"`a *b*`", []models.RichInline{{Type: models.InlineCode, Text: "a *b*"}}},
+		{`\*not italic\*`, []models.RichInline{text("*not italic*")}},
+		{"hi @alice.", []models.RichInline{text("hi "), {Type: models.InlineMention, Text: "alice"}, text(".")}},
+		{"me@example.com", []models.RichInline{text("me@example.com")}},
+		{":party_parrot: now", []models.RichInline{{Type: models.InlineEmoji, Text: "party_parrot"}, text(" now")}},
+		{"at 10:30:00", []models.RichInline{text("at 10:30:00")}},
+		{"::party::", []models.RichInline{text("::party::")}},
+		{":Party:", []models.RichInline{text(":Party:")}},
+		{"`:party:`", []models.RichInline{{Type: models.InlineCode, Text: ":party:"}}},
+	}
+	for _, tt := range tests {
+		if got := inlines(t, tt.src); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) inlines = %+v, want %+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestParseBlocks(t *testing.T) {
+	rich := Parse("```go\n<b>x</b>\n```\n> quoted\n- one\n- two")
+	if len(rich.Blocks) != 3 {
+		t.Fatalf("got %d blocks, want 3: %+v", len(rich.Blocks), rich.Blocks)
+	}
+	code := rich.Blocks[0]
+	if code.Type != models.BlockCode || code.Language != "go" || code.Text != "<b>x</b>" {
+		t.Errorf("code block = %+v", code)
+	}
+	if rich.Blocks[1].Type != models.BlockQuote {
+		t.Errorf("second block type = %q, want %q", rich.Blocks[1].Type, models.BlockQuote)
+	}
+	list := rich.Blocks[2]
+	if list.Type != models.BlockList || list.Ordered || len(list.Items) != 2 {
+		t.Errorf("list block = %+v", list)
+	}
+}
+
+func TestParseLimitsNesting(t *testing.T) {
+	// Deep nesting must stop at maxDepth rather than recursing without bound
+	src := strings.Repeat(">", 1000) + " deep"
+	rich := Parse(src)
+	depth := 0
+	for blocks := rich.Blocks; len(blocks) > 0 && blocks[0].Type == models.BlockQuote; blocks = blocks[0].Blocks {
+		depth++
+	}
+	if depth > maxDepth+1 {
+		t.Errorf("quotes nested %d deep, want at most %d", depth, maxDepth+1)
+	}
+}
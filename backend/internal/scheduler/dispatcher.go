@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	ws "go-react-chat/kalpesh-vala/github.com/internal/websocket"
+	"go-react-chat/kalpesh-vala/github.com/services"
+)
+
+const (
+	// pollInterval is how often the dispatcher looks for due messages
+	pollInterval = 5 * time.Second
+	// claimLease is how long a claimed message is reserved for one instance.
+	// A message still unsent after the lease is picked up by another instance.
+	claimLease = 2 * time.Minute
+)
+
+// Dispatcher sends scheduled messages once they are due. Every server
+// instance runs one; claims in MongoDB keep them from sending the same message.
+type Dispatcher struct {
+	Hub *ws.Hub
+	ID  string // identifies this instance's claims
+}
+
+// NewDispatcher creates a dispatcher that broadcasts through hub
+func NewDispatcher(hub *ws.Hub) *Dispatcher {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return &Dispatcher{
+		Hub: hub,
+		ID:  fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix)),
+	}
+}
+
+// Run dispatches due messages until ctx is cancelled. The first pass runs
+// immediately so messages that fell due while the server was down go out on start.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatchDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchDue sends every message that is currently due
+func (d *Dispatcher) dispatchDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		sm, err := services.ClaimDueScheduledMessage(ctx, d.ID, claimLease)
+		if err != nil {
+			log.Println("Failed to claim scheduled message:", err)
+			return
+		}
+		if sm == nil {
+			return
+		}
+
+		msg, err := services.DeliverScheduledMessage(ctx, sm, d.ID)
+		if err != nil {
+			// The claim expires and the message is retried later
+			log.Printf("Failed to send scheduled message %s: %v", sm.ID.Hex(), err)
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		d.Hub.BroadcastMessage(msg)
+		d.Hub.BroadcastThreadUpdate(msg)
+		d.Hub.NotifyRoomMembers(msg)
+		d.Hub.NotifyMentions(msg)
+	}
+}
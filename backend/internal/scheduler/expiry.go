@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	ws "go-react-chat/kalpesh-vala/github.com/internal/websocket"
+	"go-react-chat/kalpesh-vala/github.com/services"
+)
+
+// expiryInterval is how often disappearing messages are swept. MongoDB's own
+// TTL monitor only runs once a minute and cannot tell clients what it removed.
+const expiryInterval = 10 * time.Second
+
+// ExpirySweeper removes disappearing messages once they expire and tells
+// connected clients to drop them
+type ExpirySweeper struct {
+	Hub *ws.Hub
+}
+
+// NewExpirySweeper creates a sweeper that broadcasts through hub
+func NewExpirySweeper(hub *ws.Hub) *ExpirySweeper {
+	return &ExpirySweeper{Hub: hub}
+}
+
+// Run sweeps expired messages until ctx is cancelled
+func (s *ExpirySweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+
+	for {
+		s.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep removes expired messages batch by batch until none are left
+func (s *ExpirySweeper) sweep(ctx context.Context) {
+	for ctx.Err() == nil {
+		expired, err := services.DeleteExpiredMessages(ctx)
+		if err != nil {
+			log.Println("Failed to delete expired messages:", err)
+			return
+		}
+		if len(expired) == 0 {
+			return
+		}
+
+		for roomID, ids := range expired {
+			messageIDs := make([]string, 0, len(ids))
+			for _, id := range ids {
+				messageIDs = append(messageIDs, id.Hex())
+			}
+			s.Hub.BroadcastEvent(roomID, ws.ExpirePayload{
+				Type:       "expire",
+				RoomID:     roomID,
+				MessageIDs: messageIDs,
+			})
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// Fetch limits
+const (
+	fetchTimeout  = 5 * time.Second
+	dialTimeout   = 3 * time.Second
+	maxRedirects  = 5
+	maxFetchBytes = 512 * 1024 // page metadata lives in <head>, the rest is not needed
+)
+
+var (
+	// ErrBlockedAddress is returned when a URL resolves to a private, loopback or otherwise internal address
+	ErrBlockedAddress = errors.New("address is not publicly routable")
+	// ErrUnsupportedScheme is returned for URLs that are not http or https
+	ErrUnsupportedScheme = errors.New("only http and https links are fetched")
+)
+
+// Page is a fetched document
+type Page struct {
+	URL         string // final URL after redirects
+	ContentType string
+	Body        []byte // at most the fetcher's size limit, possibly truncated
+}
+
+// Fetcher retrieves pages for unfurling. HTTPFetcher is used in production;
+// tests can supply one backed by a local HTTP server.
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string) (*Page, error)
+}
+
+// HTTPFetcher fetches pages over the public internet. It refuses to connect
+// to internal addresses, checking every address it dials so redirects and
+// DNS answers cannot point it at the server's own network.
+type HTTPFetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// NewHTTPFetcher creates a fetcher with the default timeouts and size limit
+func NewHTTPFetcher() *HTTPFetcher {
+	dialer := &net.Dialer{
+		Timeout: dialTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil || isBlockedAddr(addr.Addr()) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		// No proxy: the dial check must see the real destination
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   dialTimeout,
+		ResponseHeaderTimeout: fetchTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	return &HTTPFetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   fetchTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return ErrUnsupportedScheme
+				}
+				return nil
+			},
+		},
+		maxBytes: maxFetchBytes,
+	}
+}
+
+// Fetch downloads rawURL, reading at most the size limit of the body
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, ErrUnsupportedScheme
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; ChatLinkPreview/1.0)")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/json;q=0.9,*/*;q=0.5")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes))
+	if err != nil {
+		return nil, err
+	}
+	return &Page{
+		URL:         resp.Request.URL.String(),
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        body,
+	}, nil
+}
+
+// blockedPrefixes are special-purpose ranges not covered by the netip helpers
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, includes broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, may embed a private IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4, may embed a private IPv4 address
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001::/32"),       // Teredo
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+}
+
+// isBlockedAddr reports whether addr is loopback, private, link-local or
+// otherwise not a public unicast address
+func isBlockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || !addr.IsGlobalUnicast() || addr.IsPrivate() ||
+		addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestIsBlockedAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"8.8.8.8", false},
+		{"1.1.1.1", false},
+		{"2606:4700:4700::1111", false},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true}, // cloud metadata
+		{"fe80::1", true},
+		{"fc00::1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"100.64.0.1", true},
+		{"198.18.0.1", true},
+		{"255.255.255.255", true},
+		{"224.0.0.1", true},
+		{"::ffff:127.0.0.1", true}, // IPv4-mapped loopback
+		{"::ffff:10.0.0.1", true},
+		{"64:ff9b::a00:1", true}, // NAT64 of 10.0.0.1
+		{"2002:a00:1::", true},   // 6to4 of 10.0.0.1
+		{"2001:db8::1", true},
+	}
+	for _, tt := range tests {
+		addr := netip.MustParseAddr(tt.addr)
+		if got := isBlockedAddr(addr); got != tt.blocked {
+			t.Errorf("isBlockedAddr(%s) = %v, want %v", tt.addr, got, tt.blocked)
+		}
+	}
+	if !isBlockedAddr(netip.Addr{}) {
+		t.Error("isBlockedAddr(invalid) = false, want true")
+	}
+}
+
+func TestFetchRejectsUnsupportedScheme(t *testing.T) {
+	f := NewHTTPFetcher()
+	for _, rawURL := range []string{"ftp://example.com/file", "file:///etc/passwd", "gopher://example.com"} {
+		if _, err := f.Fetch(context.Background(), rawURL); !errors.Is(err, ErrUnsupportedScheme) {
+			t.Errorf("Fetch(%q) error = %v, want ErrUnsupportedScheme", rawURL, err)
+		}
+	}
+}
+
+func TestFetchBlocksLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback server")
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPFetcher().Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Fetch(%s) error = %v, want ErrBlockedAddress", server.URL, err)
+	}
+}
+
+// publicHost is a name the tests treat as a public site. Connections to it go
+// to a local test server without the address check; every other connection,
+// including the ones redirects make, goes through the fetcher's own dialer.
+const publicHost = "public.example:80"
+
+func fetcherWithPublicHost(t *testing.T, server *httptest.Server) *HTTPFetcher {
+	t.Helper()
+	f := NewHTTPFetcher()
+	transport := f.client.Transport.(*http.Transport).Clone()
+	guarded := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address == publicHost {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		}
+		return guarded(ctx, network, address)
+	}
+	f.client.Transport = transport
+	return f
+}
+
+func TestFetchFollowsRedirectsOnPublicHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/page", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>ok</title>"))
+	}))
+	defer server.Close()
+
+	page, err := fetcherWithPublicHost(t, server).Fetch(context.Background(), "http://public.example/start")
+	if err != nil {
+		t.Fatalf("Fetch error = %v", err)
+	}
+	if page.URL != "http://public.example/page" || string(page.Body) != "<title>ok</title>" {
+		t.Errorf("page = %+v", page)
+	}
+}
+
+func TestFetchBlocksRedirectToInternalAddress(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("redirect reached a loopback server")
+	}))
+	defer internal.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/admin", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := fetcherWithPublicHost(t, server).Fetch(context.Background(), "http://public.example/")
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Fetch error = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestFetchBlocksRedirectToUnsupportedScheme(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "ftp://public.example/file", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := fetcherWithPublicHost(t, server).Fetch(context.Background(), "http://public.example/")
+	if !errors.Is(err, ErrUnsupportedScheme) {
+		t.Fatalf("Fetch error = %v, want ErrUnsupportedScheme", err)
+	}
+}
+
+func TestFetchStopsRedirectLoops(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/again", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := fetcherWithPublicHost(t, server).Fetch(context.Background(), "http://public.example/")
+	if err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Fatalf("Fetch error = %v, want a redirect limit error", err)
+	}
+}
+
+func TestFetchLimitsBodySize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 1024)))
+	}))
+	defer server.Close()
+
+	f := fetcherWithPublicHost(t, server)
+	f.maxBytes = 100
+	page, err := f.Fetch(context.Background(), "http://public.example/")
+	if err != nil {
+		t.Fatalf("Fetch error = %v", err)
+	}
+	if len(page.Body) != 100 {
+		t.Errorf("body length = %d, want 100", len(page.Body))
+	}
+}
@@ -0,0 +1,201 @@
+package unfurl
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// Field length limits, in runes
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 500
+	maxSiteNameLength    = 100
+)
+
+// pageMeta is what a page says about itself
+type pageMeta struct {
+	ogTitle, ogDescription, ogImage, ogSiteName    string
+	twitterTitle, twitterDescription, twitterImage string
+	title, description                             string
+	oembedURL                                      string
+}
+
+// parseHTML reads the metadata in a page's <head>. Relative URLs are
+// resolved against base.
+func parseHTML(page *Page, base *url.URL) pageMeta {
+	var meta pageMeta
+	body, err := charset.NewReader(bytes.NewReader(page.Body), page.ContentType)
+	if err != nil {
+		return meta
+	}
+
+	z := html.NewTokenizer(body)
+	inTitle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return meta
+		case html.TextToken:
+			if inTitle && meta.title == "" {
+				meta.title = string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return meta
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				return meta
+			case "title":
+				inTitle = true
+			case "meta":
+				if hasAttr {
+					meta.readMeta(tagAttrs(z))
+				}
+			case "link":
+				if hasAttr {
+					attrs := tagAttrs(z)
+					if strings.EqualFold(attrs["type"], "application/json+oembed") && meta.oembedURL == "" {
+						meta.oembedURL = resolveURL(base, attrs["href"])
+					}
+				}
+			}
+		}
+	}
+}
+
+// readMeta records one <meta> tag. OpenGraph uses property=, most others name=.
+func (m *pageMeta) readMeta(attrs map[string]string) {
+	key := strings.ToLower(attrs["property"])
+	if key == "" {
+		key = strings.ToLower(attrs["name"])
+	}
+	content := attrs["content"]
+	if content == "" {
+		return
+	}
+
+	var field *string
+	switch key {
+	case "og:title":
+		field = &m.ogTitle
+	case "og:description":
+		field = &m.ogDescription
+	case "og:image", "og:image:url", "og:image:secure_url":
+		field = &m.ogImage
+	case "og:site_name":
+		field = &m.ogSiteName
+	case "twitter:title":
+		field = &m.twitterTitle
+	case "twitter:description":
+		field = &m.twitterDescription
+	case "twitter:image", "twitter:image:src":
+		field = &m.twitterImage
+	case "description":
+		field = &m.description
+	default:
+		return
+	}
+	// The first tag wins, as crawlers do
+	if *field == "" {
+		*field = content
+	}
+}
+
+// tagAttrs collects the current tag's attributes, keyed by lower-case name
+func tagAttrs(z *html.Tokenizer) map[string]string {
+	attrs := map[string]string{}
+	for {
+		key, val, more := z.TagAttr()
+		attrs[strings.ToLower(string(key))] = string(val)
+		if !more {
+			return attrs
+		}
+	}
+}
+
+// preview combines the metadata, preferring OpenGraph over Twitter cards over plain HTML
+func (m *pageMeta) preview(rawURL string, base *url.URL) *models.LinkPreview {
+	return &models.LinkPreview{
+		URL:         rawURL,
+		Title:       clean(firstNonEmpty(m.ogTitle, m.twitterTitle, m.title), maxTitleLength),
+		Description: clean(firstNonEmpty(m.ogDescription, m.twitterDescription, m.description), maxDescriptionLength),
+		ImageURL:    resolveURL(base, firstNonEmpty(m.ogImage, m.twitterImage)),
+		SiteName:    clean(m.ogSiteName, maxSiteNameLength),
+	}
+}
+
+// oembed is the part of an oEmbed response used for previews
+type oembed struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// applyOEmbed fills fields the page's own tags left empty
+func applyOEmbed(p *models.LinkPreview, body []byte, base *url.URL) {
+	var data oembed
+	if err := json.Unmarshal(body, &data); err != nil {
+		return
+	}
+	if p.Title == "" {
+		p.Title = clean(data.Title, maxTitleLength)
+	}
+	if p.Description == "" && data.AuthorName != "" {
+		p.Description = clean("by "+data.AuthorName, maxDescriptionLength)
+	}
+	if p.SiteName == "" {
+		p.SiteName = clean(data.ProviderName, maxSiteNameLength)
+	}
+	if p.ImageURL == "" {
+		p.ImageURL = resolveURL(base, data.ThumbnailURL)
+	}
+}
+
+// resolveURL makes ref absolute against base. Anything but an http or
+// https URL is dropped, since clients load these directly.
+func resolveURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
+
+// clean collapses whitespace and truncates s to max runes
+func clean(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
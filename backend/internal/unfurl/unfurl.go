@@ -0,0 +1,161 @@
+// Package unfurl builds link previews for URLs in messages from the pages'
+// OpenGraph tags and oEmbed data. Results, including failures, are cached
+// in Redis so a popular link is fetched once.
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/url"
+	"time"
+
+	"go-react-chat/kalpesh-vala/github.com/db/redis"
+	"go-react-chat/kalpesh-vala/github.com/models"
+)
+
+// Unfurling limits
+const (
+	MaxLinksPerMessage = 3
+	unfurlTimeout      = 10 * time.Second // one link, including its oEmbed request
+	previewCacheTTL    = 24 * time.Hour
+	failureCacheTTL    = 15 * time.Minute
+)
+
+// Unfurler turns links into previews
+type Unfurler struct {
+	Fetcher Fetcher
+}
+
+// New creates an unfurler that fetches pages with f
+func New(f Fetcher) *Unfurler {
+	return &Unfurler{Fetcher: f}
+}
+
+// Previews unfurls the links in a message's rich text, skipping links
+// without a preview. Results keep the order the links appear in.
+func (u *Unfurler) Previews(ctx context.Context, rich *models.RichText) []models.LinkPreview {
+	var previews []models.LinkPreview
+	for _, link := range Links(rich) {
+		preview, err := u.Unfurl(ctx, link)
+		if err != nil {
+			log.Printf("Failed to unfurl %s: %v", link, err)
+			continue
+		}
+		if preview != nil {
+			previews = append(previews, *preview)
+		}
+	}
+	return previews
+}
+
+// Unfurl returns the preview for one URL, or nil when the page has nothing
+// to show or could not be fetched
+func (u *Unfurler) Unfurl(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	if data, ok, err := redis.GetLinkPreview(rawURL); err != nil {
+		log.Println("Failed to read link preview cache:", err)
+	} else if ok {
+		if len(data) == 0 {
+			return nil, nil
+		}
+		var preview models.LinkPreview
+		if err := json.Unmarshal(data, &preview); err == nil {
+			return &preview, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, unfurlTimeout)
+	defer cancel()
+	preview, err := u.fetchPreview(ctx, rawURL)
+	if err != nil && ctx.Err() == context.Canceled {
+		// Shutting down, not the page's fault; leave it uncached
+		return nil, err
+	}
+
+	var data []byte
+	ttl := failureCacheTTL
+	if preview != nil {
+		data, _ = json.Marshal(preview)
+		ttl = previewCacheTTL
+	}
+	if cacheErr := redis.SetLinkPreview(rawURL, data, ttl); cacheErr != nil {
+		log.Println("Failed to cache link preview:", cacheErr)
+	}
+	return preview, err
+}
+
+// fetchPreview fetches the page, then its oEmbed document if the page links one
+func (u *Unfurler) fetchPreview(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	page, err := u.Fetcher.Fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(page.URL)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(page.ContentType)
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, nil
+	}
+
+	meta := parseHTML(page, base)
+	preview := meta.preview(rawURL, base)
+	if meta.oembedURL != "" && (preview.Title == "" || preview.ImageURL == "" || preview.SiteName == "") {
+		if doc, err := u.Fetcher.Fetch(ctx, meta.oembedURL); err == nil {
+			applyOEmbed(preview, doc.Body, base)
+		}
+	}
+	if preview.SiteName == "" {
+		preview.SiteName = base.Hostname()
+	}
+	if preview.IsEmpty() {
+		return nil, nil
+	}
+	return preview, nil
+}
+
+// Links lists the distinct http and https links in rich text, up to
+// MaxLinksPerMessage. Code blocks and inline code are not searched.
+func Links(rich *models.RichText) []string {
+	if rich == nil {
+		return nil
+	}
+	var links []string
+	seen := map[string]bool{}
+	var walkInlines func([]models.RichInline) bool
+	walkInlines = func(inlines []models.RichInline) bool {
+		for _, in := range inlines {
+			if in.Type == models.InlineLink && !seen[in.URL] {
+				if u, err := url.Parse(in.URL); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+					seen[in.URL] = true
+					links = append(links, in.URL)
+					if len(links) == MaxLinksPerMessage {
+						return false
+					}
+				}
+			}
+			if !walkInlines(in.Children) {
+				return false
+			}
+		}
+		return true
+	}
+	var walkBlocks func([]models.RichBlock) bool
+	walkBlocks = func(blocks []models.RichBlock) bool {
+		for _, b := range blocks {
+			if !walkInlines(b.Inlines) || !walkBlocks(b.Blocks) {
+				return false
+			}
+			for _, item := range b.Items {
+				if !walkInlines(item) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	walkBlocks(rich.Blocks)
+	return links
+}
@@ -1,21 +1,42 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"go-react-chat/kalpesh-vala/github.com/internal/commands"
 	"go-react-chat/kalpesh-vala/github.com/models"
+	"go-react-chat/kalpesh-vala/github.com/services"
 
 	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// Frame is one frame queued for a connection. Delivery is set on a new
+// message for a recipient, and its delivery is recorded once it is written.
+type Frame struct {
+	Data     []byte
+	Delivery *models.Message
+}
+
 type Client struct {
 	RoomID   string
 	Conn     *websocket.Conn
-	Send     chan []byte
+	Send     chan Frame
 	Hub      *Hub
 	UserID   string
 	Username string
+
+	// mu guards closed, so frames this connection queues for itself are
+	// never sent on Send after the hub has closed it
+	mu     sync.Mutex
+	closed bool
 }
 
 func (c *Client) ReadPump() {
@@ -28,6 +49,10 @@ func (c *Client) ReadPump() {
 		if err != nil {
 			break
 		}
+		if !utf8.Valid(message) {
+			c.sendJSON(ErrorPayload{Type: "error", Error: "Frame is not valid UTF-8", Code: services.ContentInvalidUTF8})
+			continue
+		}
 		var payload MessagePayload
 		if err := json.Unmarshal(message, &payload); err != nil {
 			continue
@@ -37,12 +62,9 @@ func (c *Client) ReadPump() {
 		switch payload.Type {
 		case "ping":
 			// Respond to ping with pong
-			pongResponse := map[string]interface{}{
+			c.sendJSON(map[string]interface{}{
 				"type": "pong",
-			}
-			if pongBytes, err := json.Marshal(pongResponse); err == nil {
-				c.Send <- pongBytes
-			}
+			})
 			continue
 
 		case "typing":
@@ -56,25 +78,69 @@ func (c *Client) ReadPump() {
 			}
 			continue
 
-		case "reaction":
-			// Handle reaction updates - broadcast without storing here
-			if broadcastBytes, err := json.Marshal(payload); err == nil {
-				broadcastPayload := MessagePayload{
-					RoomID:  payload.RoomID,
-					Message: broadcastBytes,
-				}
-				c.Hub.Broadcast <- broadcastPayload
+		case "edit":
+			// Edit a stored message; only its sender may do this
+			msgID, err := primitive.ObjectIDFromHex(payload.MessageID)
+			if err != nil {
+				c.sendJSON(ErrorPayload{Type: "error", Error: "Invalid message ID", Code: "invalid_message_id"})
+				continue
+			}
+			edited, mentioned, err := services.EditMessage(context.Background(), msgID, c.userID(), payload.Content)
+			if contentErr, ok := err.(*services.ContentError); ok {
+				c.sendJSON(contentErrorPayload(contentErr, payload.RoomID, ""))
+				continue
+			}
+			if err != nil {
+				c.sendJSON(ErrorPayload{
+					Type:   "error",
+					Error:  err.Error(),
+					Code:   editErrorCode(err),
+					RoomID: payload.RoomID,
+				})
+				continue
 			}
+			c.Hub.BroadcastEvent(edited.RoomID, NewEditPayload(edited))
+			c.Hub.QueueUnfurl(edited)
+			c.Hub.NotifyMentioned(edited, mentioned)
 			continue
 
-		case "deletion":
-			// Handle message deletion - broadcast the deletion event
-			if broadcastBytes, err := json.Marshal(payload); err == nil {
-				broadcastPayload := MessagePayload{
-					RoomID:  payload.RoomID,
-					Message: broadcastBytes,
+		case "vote":
+			// Vote on a poll, or change or withdraw an earlier vote
+			msgID, err := primitive.ObjectIDFromHex(payload.MessageID)
+			if err != nil {
+				c.sendJSON(ErrorPayload{Type: "error", Error: "Invalid message ID", Code: "invalid_message_id"})
+				continue
+			}
+			poll, err := services.VotePoll(context.Background(), msgID, c.userID(), payload.OptionIDs)
+			if err != nil {
+				c.sendJSON(ErrorPayload{Type: "error", Error: err.Error(), Code: pollErrorCode(err), RoomID: payload.RoomID})
+				continue
+			}
+			c.Hub.BroadcastPoll(poll)
+			continue
+
+		case "read":
+			// Move the reader's position forward and tell the room
+			var readID *primitive.ObjectID
+			if payload.MessageID != "" {
+				id, err := primitive.ObjectIDFromHex(payload.MessageID)
+				if err != nil {
+					c.sendJSON(ErrorPayload{Type: "error", Error: "Invalid message ID", Code: "invalid_message_id"})
+					continue
 				}
-				c.Hub.Broadcast <- broadcastPayload
+				readID = &id
+			}
+			member, err := services.MarkRoomRead(context.Background(), payload.RoomID, c.userID(), readID)
+			if err == services.ErrReadMessageNotInRoom {
+				c.sendJSON(ErrorPayload{Type: "error", Error: err.Error(), Code: "not_found", RoomID: payload.RoomID})
+				continue
+			}
+			if err != nil {
+				c.sendJSON(ErrorPayload{Type: "error", Error: "Failed to mark messages as read", Code: "read_failed", RoomID: payload.RoomID})
+				continue
+			}
+			if member.LastReadMessageID != nil {
+				c.Hub.BroadcastRead(payload.RoomID, c.userID(), member.LastReadMessageID.Hex())
 			}
 			continue
 
@@ -84,83 +150,292 @@ func (c *Client) ReadPump() {
 			if payload.MessageID != "" {
 				// This message already has an ID, so it's already been saved to the database
 				// Just broadcast it without saving again
-				println("Received message with existing ID:", payload.MessageID, "- skipping database save")
-
-				// Just broadcast the existing message
-				if broadcastBytes, err := json.Marshal(payload); err == nil {
-					broadcastPayload := MessagePayload{
-						RoomID:  payload.RoomID,
-						Message: broadcastBytes,
-					}
-					c.Hub.Broadcast <- broadcastPayload
+
+				// Rebroadcast the stored copy rather than what the client sent,
+				// and only for the sender's own messages
+				msgID, err := primitive.ObjectIDFromHex(payload.MessageID)
+				if err != nil {
+					c.sendJSON(ErrorPayload{Type: "error", Error: "Invalid message ID", Code: "invalid_message_id"})
+					continue
 				}
+				stored, err := services.GetMessageByID(context.Background(), msgID)
+				if err != nil || stored.SenderID != c.userID() || stored.Deleted {
+					c.sendJSON(ErrorPayload{Type: "error", Error: "Message not found", Code: "not_found"})
+					continue
+				}
+				c.Hub.BroadcastEvent(stored.RoomID, NewMessagePayload(stored))
+				continue
+			}
+
+			// Messages are always sent as the authenticated user
+			payload.SenderID = c.userID()
+			allowed, err := services.CanPostToRoom(context.Background(), payload.RoomID, payload.SenderID)
+			if err != nil || !allowed {
+				c.sendJSON(ErrorPayload{
+					Type:        "error",
+					Error:       "You are not a member of this room",
+					RoomID:      payload.RoomID,
+					ClientMsgID: payload.ClientMsgID,
+				})
+				continue
+			}
+
+			// Slash commands run instead of being stored
+			if commands.IsCommand(payload.Content) && payload.AttachmentURL == "" {
+				c.runCommand(payload.RoomID, payload.Content)
 				continue
 			}
+			payload.Content = commands.Unescape(payload.Content)
+
+			// A resend of a message that was already stored is only acknowledged again
+			if payload.ClientMsgID != "" {
+				stored, errFrame := c.findResend(payload.RoomID, payload.ClientMsgID)
+				if errFrame != nil {
+					c.sendJSON(errFrame)
+					continue
+				}
+				if stored != nil {
+					c.sendJSON(NewAckPayload(stored, true))
+					continue
+				}
+			}
 
 			// This is a new message without an ID, so store it in database
+			_, isDirect := services.PrivateRoomParticipants(payload.RoomID)
 			msg := models.Message{
 				RoomID:         payload.RoomID,
 				SenderID:       payload.SenderID,
+				ClientMsgID:    payload.ClientMsgID,
 				Message:        payload.Content,
 				Timestamp:      time.Now().Unix(),
-				IsGroup:        payload.IsGroup,
-				Status:         "sent",
+				IsGroup:        !isDirect,
+				Status:         models.MessageStatusSent,
 				AttachmentURL:  payload.AttachmentURL,
 				AttachmentType: payload.AttachmentType,
 				Deleted:        false,
 			}
 
+			if payload.ReplyToID != "" {
+				replyToID, err := primitive.ObjectIDFromHex(payload.ReplyToID)
+				if err != nil {
+					c.sendJSON(ErrorPayload{Type: "error", Error: "Invalid reply_to_id", Code: "invalid_reply", RoomID: payload.RoomID, ClientMsgID: payload.ClientMsgID})
+					continue
+				}
+				msg.ReplyToID = &replyToID
+			}
+
 			// Skip empty messages
 			if msg.Message == "" && msg.AttachmentURL == "" {
-				errorResponse := map[string]interface{}{
-					"type":  "error",
-					"error": "Empty message",
-				}
-				if errorBytes, err := json.Marshal(errorResponse); err == nil {
-					c.Send <- errorBytes
+				c.sendJSON(ErrorPayload{Type: "error", Error: "Empty message", RoomID: payload.RoomID, ClientMsgID: payload.ClientMsgID})
+				continue
+			}
+			if err := services.ValidateContent(msg.Message, msg.AttachmentURL, msg.AttachmentType); err != nil {
+				if contentErr, ok := err.(*services.ContentError); ok {
+					c.sendJSON(contentErrorPayload(contentErr, msg.RoomID, msg.ClientMsgID))
+				} else {
+					c.sendJSON(ErrorPayload{Type: "error", Error: "Failed to check message content", RoomID: msg.RoomID, ClientMsgID: msg.ClientMsgID})
 				}
 				continue
 			}
 
-			// Store message in MongoDB
-			if err := c.Hub.StoreMessage(&msg); err != nil {
-				// Send error back to client
-				errorResponse := map[string]interface{}{
-					"type":  "error",
-					"error": "Failed to store message",
+			if err := services.EnforcePostingPolicy(context.Background(), msg.RoomID, msg.SenderID, msg.AttachmentURL != ""); err != nil {
+				errorResponse := ErrorPayload{
+					Type:        "error",
+					Error:       "Failed to check room policy",
+					RoomID:      msg.RoomID,
+					ClientMsgID: msg.ClientMsgID,
 				}
-				if errorBytes, err := json.Marshal(errorResponse); err == nil {
-					c.Send <- errorBytes
+				if policyErr, ok := err.(*services.PolicyError); ok {
+					errorResponse.Error = policyErr.Message
+					errorResponse.Code = policyErr.Code
+					errorResponse.RetryAfter = policyErr.RetryAfter
 				}
+				c.sendJSON(errorResponse)
 				continue
 			}
 
-			// Update payload with stored message ID and broadcast
-			payload.MessageID = msg.ID.Hex()
-			payload.Timestamp = msg.Timestamp
-
-			// Convert payload to JSON for broadcasting
-			if broadcastBytes, err := json.Marshal(payload); err == nil {
-				broadcastPayload := MessagePayload{
-					RoomID:  payload.RoomID,
-					Message: broadcastBytes,
+			// Store message in MongoDB
+			err = c.Hub.StoreMessage(&msg)
+			if err != nil {
+				services.ReleasePostingSlot(msg.RoomID, msg.SenderID)
+			}
+			switch err {
+			case nil:
+			case services.ErrDuplicateMessage:
+				// The original was stored while this resend was being checked
+				c.sendJSON(NewAckPayload(&msg, true))
+				continue
+			case services.ErrInvalidReplyParent:
+				c.sendJSON(ErrorPayload{Type: "error", Error: err.Error(), Code: "invalid_reply", RoomID: payload.RoomID, ClientMsgID: payload.ClientMsgID})
+				continue
+			default:
+				if contentErr, ok := err.(*services.ContentError); ok {
+					c.sendJSON(contentErrorPayload(contentErr, payload.RoomID, payload.ClientMsgID))
+					continue
 				}
-				c.Hub.Broadcast <- broadcastPayload
+				c.sendJSON(ErrorPayload{Type: "error", Error: "Failed to store message", RoomID: payload.RoomID, ClientMsgID: payload.ClientMsgID})
+				continue
 			}
 
+			// Tell the sender the message's ID, then broadcast it with its new ID and timestamp
+			c.sendJSON(NewAckPayload(&msg, false))
+			c.Hub.BroadcastMessage(&msg)
+			c.Hub.BroadcastThreadUpdate(&msg)
+			c.Hub.NotifyRoomMembers(&msg)
+			c.Hub.NotifyMentions(&msg)
+			c.Hub.ClearDraft(msg.SenderID, msg.RoomID)
+
 		default:
 			// Unknown message type, log and ignore
-			println("Unknown message type received:", payload.Type)
+			log.Println("Unknown message type received:", payload.Type)
 			continue
 		}
 	}
 }
 
+// runCommand executes a slash command for this connection's user. The reply
+// and any error go back to this connection only.
+func (c *Client) runCommand(roomID, content string) {
+	result, err := commands.Execute(context.Background(), roomID, c.userID(), content)
+	if err != nil {
+		errorResponse := ErrorPayload{Type: "error", Error: "Failed to run command", Code: commands.CodeFailed, RoomID: roomID}
+		switch e := err.(type) {
+		case *commands.Error:
+			errorResponse.Error, errorResponse.Code = e.Message, e.Code
+		case *services.PolicyError:
+			errorResponse.Error, errorResponse.Code, errorResponse.RetryAfter = e.Message, e.Code, e.RetryAfter
+		case *services.ContentError:
+			errorResponse = contentErrorPayload(e, roomID, "")
+		default:
+			log.Println("Failed to run command:", err)
+		}
+		c.sendJSON(errorResponse)
+		return
+	}
+
+	c.Hub.PublishCommandResult(roomID, result)
+	c.Hub.ClearDraft(c.userID(), roomID)
+	if result.Reply != "" {
+		c.sendJSON(CommandPayload{Type: "command", RoomID: roomID, Command: result.Command, Text: result.Reply})
+	}
+}
+
+// findResend looks up the message this user already stored under a client
+// message ID. It returns nil, nil for a new ID, or the error frame to send.
+func (c *Client) findResend(roomID, clientMsgID string) (*models.Message, *ErrorPayload) {
+	errorResponse := &ErrorPayload{Type: "error", RoomID: roomID, ClientMsgID: clientMsgID}
+	if err := services.ValidateClientMsgID(clientMsgID); err != nil {
+		errorResponse.Error, errorResponse.Code = err.Error(), "invalid_client_msg_id"
+		return nil, errorResponse
+	}
+	stored, err := services.FindClientMessage(context.Background(), c.userID(), roomID, clientMsgID)
+	switch err {
+	case nil:
+		return stored, nil
+	case mongo.ErrNoDocuments:
+		return nil, nil
+	case services.ErrClientMsgIDInUse:
+		errorResponse.Error, errorResponse.Code = err.Error(), "client_msg_id_in_use"
+	default:
+		log.Println("Failed to look up client message ID:", err)
+		errorResponse.Error = "Failed to store message"
+	}
+	return nil, errorResponse
+}
+
+// contentErrorPayload builds the error frame for message content over the server's limits
+func contentErrorPayload(err *services.ContentError, roomID, clientMsgID string) ErrorPayload {
+	return ErrorPayload{
+		Type:        "error",
+		Error:       err.Message,
+		Code:        err.Code,
+		RoomID:      roomID,
+		ClientMsgID: clientMsgID,
+		Limit:       err.Limit,
+	}
+}
+
+// sendJSON marshals a frame and queues it for this connection only. The frame
+// is dropped if the hub has closed the connection or its queue is full.
+func (c *Client) sendJSON(v interface{}) {
+	frameBytes, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.Send <- Frame{Data: frameBytes}:
+	default:
+		log.Println("Dropped frame for slow connection of user", c.UserID)
+	}
+}
+
+// close closes the connection's send queue. Only the hub calls it.
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	close(c.Send)
+}
+
+// editErrorCode maps an edit failure to the code sent in the error frame
+func editErrorCode(err error) string {
+	switch err {
+	case services.ErrNotMessageSender:
+		return "not_sender"
+	case services.ErrMessageDeleted:
+		return "message_deleted"
+	case services.ErrEditWindowExpired:
+		return "edit_window_expired"
+	case services.ErrEditConflict:
+		return "edit_conflict"
+	case services.ErrEmptyMessage:
+		return "empty_message"
+	case services.ErrMessageNotEditable:
+		return "not_editable"
+	case mongo.ErrNoDocuments:
+		return "not_found"
+	}
+	return "edit_failed"
+}
+
+// pollErrorCode maps a vote failure to the code sent in the error frame
+func pollErrorCode(err error) string {
+	switch err {
+	case services.ErrNotAPoll:
+		return "not_a_poll"
+	case services.ErrPollClosed:
+		return "poll_closed"
+	case services.ErrInvalidVote:
+		return "invalid_vote"
+	case services.ErrNotRoomMember:
+		return "not_member"
+	case services.ErrMessageDeleted:
+		return "message_deleted"
+	case mongo.ErrNoDocuments:
+		return "not_found"
+	}
+	return "vote_failed"
+}
+
+// userID returns the authenticated user's ID as stored on messages
+func (c *Client) userID() int {
+	id, _ := strconv.Atoi(c.UserID)
+	return id
+}
+
 func (c *Client) WritePump() {
 	defer c.Conn.Close()
-	for msg := range c.Send {
-		if err := c.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+	for frame := range c.Send {
+		if err := c.Conn.WriteMessage(websocket.TextMessage, frame.Data); err != nil {
 			break
 		}
+		if frame.Delivery != nil {
+			c.Hub.queueDelivery(frame.Delivery, c.userID())
+		}
 	}
 }
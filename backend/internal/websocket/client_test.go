@@ -0,0 +1,19 @@
+package websocket
+
+import "testing"
+
+func TestSendJSONAfterClose(t *testing.T) {
+	c := &Client{Send: make(chan Frame, 1)}
+	c.close()
+	// Must neither panic nor block once the hub has closed the queue
+	c.sendJSON(map[string]string{"type": "pong"})
+}
+
+func TestSendJSONDropsWhenQueueFull(t *testing.T) {
+	c := &Client{Send: make(chan Frame, 1)}
+	c.sendJSON(map[string]string{"type": "pong"})
+	c.sendJSON(map[string]string{"type": "pong"})
+	if len(c.Send) != 1 {
+		t.Errorf("queued %d frames, want 1", len(c.Send))
+	}
+}
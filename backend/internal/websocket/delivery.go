@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// deliveryQueueSize bounds how many written messages may wait to be recorded.
+// When the queue is full the delivery is not recorded; reading the room
+// records it later.
+const deliveryQueueSize = 1024
+
+// deliveryFlushInterval is how long deliveries of a message are collected,
+// so the room gets one receipt for all the recipients it reached meanwhile
+const deliveryFlushInterval = 250 * time.Millisecond
+
+// delivery is a message written to one recipient's connection
+type delivery struct {
+	Message *models.Message
+	UserID  int
+}
+
+// queueDelivery records that a message was written to a recipient's connection
+func (h *Hub) queueDelivery(msg *models.Message, userID int) {
+	select {
+	case h.deliveries <- delivery{Message: msg, UserID: userID}:
+	default:
+		log.Println("Delivery queue is full, skipping message", msg.ID.Hex())
+	}
+}
+
+// RunDeliveryRecorder records queued deliveries until ctx is cancelled.
+// Deliveries are grouped by message and stored every deliveryFlushInterval.
+func (h *Hub) RunDeliveryRecorder(ctx context.Context) {
+	ticker := time.NewTicker(deliveryFlushInterval)
+	defer ticker.Stop()
+
+	type pending struct {
+		msg        *models.Message
+		recipients []int
+		seen       map[int]bool
+	}
+	batch := map[primitive.ObjectID]*pending{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-h.deliveries:
+			p, ok := batch[d.Message.ID]
+			if !ok {
+				p = &pending{msg: d.Message, seen: map[int]bool{}}
+				batch[d.Message.ID] = p
+			}
+			// A user with several connections is one recipient
+			if !p.seen[d.UserID] {
+				p.seen[d.UserID] = true
+				p.recipients = append(p.recipients, d.UserID)
+			}
+		case <-ticker.C:
+			for id, p := range batch {
+				go h.recordDelivery(p.msg, p.recipients)
+				delete(batch, id)
+			}
+		}
+	}
+}
+
+// recordDelivery stores delivery receipts and announces them to the room.
+// Private rooms only announce the sent to delivered status change.
+func (h *Hub) recordDelivery(msg *models.Message, recipients []int) {
+	changed, err := services.MarkDelivered(context.Background(), msg, recipients)
+	if err != nil {
+		log.Println("Failed to record message delivery: ", err)
+		return
+	}
+
+	receipt := ReceiptPayload{
+		Type:      "receipt",
+		Status:    models.MessageStatusDelivered,
+		MessageID: msg.ID.Hex(),
+		RoomID:    msg.RoomID,
+	}
+	if _, ok := services.PrivateRoomParticipants(msg.RoomID); ok {
+		if !changed {
+			return
+		}
+		receipt.UserID = recipients[0]
+	} else {
+		receipt.UserIDs = recipients
+	}
+	h.BroadcastEvent(msg.RoomID, receipt)
+}
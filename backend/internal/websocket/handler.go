@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"go-react-chat/kalpesh-vala/github.com/services"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
@@ -50,15 +52,27 @@ func ServeWs(hub *Hub) gin.HandlerFunc {
 			return
 		}
 
+		allowed, err := services.CanReadRoom(c, roomId, int(userIDFloat))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room access"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this room"})
+			return
+		}
+
 		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
 			return
 		}
+		// Larger frames close the connection with code 1009 (message too big)
+		conn.SetReadLimit(services.Limits().MaxPayloadBytes)
 
 		client := &Client{
 			RoomID:   roomId,
 			Conn:     conn,
-			Send:     make(chan []byte, 256),
+			Send:     make(chan Frame, 256),
 			Hub:      hub,
 			UserID:   userID,
 			Username: username,
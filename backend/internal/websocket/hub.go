@@ -2,27 +2,49 @@ package websocket
 
 import (
 	"context"
+	"encoding/json"
 	"go-react-chat/kalpesh-vala/github.com/db/redis"
+	"go-react-chat/kalpesh-vala/github.com/internal/commands"
 	"go-react-chat/kalpesh-vala/github.com/models"
 	"go-react-chat/kalpesh-vala/github.com/services"
 	"log"
+	"strconv"
 )
 
 type Hub struct {
 	Clients    map[*Client]bool
 	Rooms      map[string]map[*Client]bool
+	Users      map[string]map[*Client]bool
 	Broadcast  chan MessagePayload
+	Direct     chan DirectPayload
 	Register   chan *Client
 	Unregister chan *Client
+
+	// Messages waiting for their links to be unfurled
+	unfurls chan unfurlJob
+	// Messages written to a recipient's connection, waiting to be recorded as delivered
+	deliveries chan delivery
+}
+
+// DirectPayload is delivered to every connection of the given users,
+// wherever they are connected, except connections to SkipRoomID
+type DirectPayload struct {
+	UserIDs    []string
+	SkipRoomID string
+	Message    []byte
 }
 
 func NewHub() *Hub {
 	return &Hub{
 		Clients:    make(map[*Client]bool),
 		Rooms:      make(map[string]map[*Client]bool),
+		Users:      make(map[string]map[*Client]bool),
 		Broadcast:  make(chan MessagePayload),
+		Direct:     make(chan DirectPayload),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
+		unfurls:    make(chan unfurlJob, unfurlQueueSize),
+		deliveries: make(chan delivery, deliveryQueueSize),
 	}
 }
 
@@ -35,6 +57,10 @@ func (h *Hub) Run() {
 				h.Rooms[client.RoomID] = make(map[*Client]bool)
 			}
 			h.Rooms[client.RoomID][client] = true
+			if _, ok := h.Users[client.UserID]; !ok {
+				h.Users[client.UserID] = make(map[*Client]bool)
+			}
+			h.Users[client.UserID][client] = true
 
 			if err := redis.SetUserOnline(client.UserID, client.RoomID); err != nil {
 				log.Println("Failed to set user online in Redis: ", err)
@@ -43,7 +69,7 @@ func (h *Hub) Run() {
 		case client := <-h.Unregister:
 			if _, ok := h.Clients[client]; ok {
 				delete(h.Clients, client)
-				close(client.Send)
+				client.close()
 			}
 			if room, ok := h.Rooms[client.RoomID]; ok {
 				delete(room, client)
@@ -51,6 +77,12 @@ func (h *Hub) Run() {
 					delete(h.Rooms, client.RoomID)
 				}
 			}
+			if conns, ok := h.Users[client.UserID]; ok {
+				delete(conns, client)
+				if len(conns) == 0 {
+					delete(h.Users, client.UserID)
+				}
+			}
 
 			if err := redis.SetUserOffline(client.UserID, client.RoomID); err != nil {
 				log.Println("Failed to set user offline in Redis: ", err)
@@ -59,12 +91,34 @@ func (h *Hub) Run() {
 		case msg := <-h.Broadcast:
 			if clients, ok := h.Rooms[msg.RoomID]; ok {
 				for client := range clients {
+					frame := Frame{Data: msg.Message}
+					if msg.Delivery != nil && client.userID() != msg.Delivery.SenderID {
+						frame.Delivery = msg.Delivery
+					}
 					select {
-					case client.Send <- msg.Message:
+					case client.Send <- frame:
 					default:
-						close(client.Send)
+						client.close()
 						delete(h.Clients, client)
 						delete(h.Rooms[msg.RoomID], client)
+						delete(h.Users[client.UserID], client)
+					}
+				}
+			}
+
+		case msg := <-h.Direct:
+			for _, userID := range msg.UserIDs {
+				for client := range h.Users[userID] {
+					if client.RoomID == msg.SkipRoomID {
+						continue
+					}
+					select {
+					case client.Send <- Frame{Data: msg.Message}:
+					default:
+						client.close()
+						delete(h.Clients, client)
+						delete(h.Rooms[client.RoomID], client)
+						delete(h.Users[userID], client)
 					}
 				}
 			}
@@ -72,6 +126,216 @@ func (h *Hub) Run() {
 	}
 }
 
+// BroadcastEvent marshals an event and sends it to every client in the room
+func (h *Hub) BroadcastEvent(roomID string, event interface{}) {
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Failed to marshal event: ", err)
+		return
+	}
+	h.Broadcast <- MessagePayload{
+		RoomID:  roomID,
+		Message: eventBytes,
+	}
+}
+
+// BroadcastMessage sends a newly stored message to its room and records
+// delivery for every recipient connection it is written to
+func (h *Hub) BroadcastMessage(msg *models.Message) {
+	msgBytes, err := json.Marshal(NewMessagePayload(msg))
+	if err != nil {
+		log.Println("Failed to marshal message: ", err)
+		return
+	}
+	h.Broadcast <- MessagePayload{
+		RoomID:   msg.RoomID,
+		Message:  msgBytes,
+		Delivery: msg,
+	}
+	h.QueueUnfurl(msg)
+}
+
+// BroadcastRead announces that a member has read a room up to a message
+func (h *Hub) BroadcastRead(roomID string, userID int, messageID string) {
+	h.BroadcastEvent(roomID, ReceiptPayload{
+		Type:      "receipt",
+		Status:    models.MessageStatusRead,
+		MessageID: messageID,
+		RoomID:    roomID,
+		UserID:    userID,
+	})
+}
+
+// SendToUsers marshals an event and sends it to every connection of the given
+// users, skipping their connections to skipRoomID (pass "" to reach all of them)
+func (h *Hub) SendToUsers(userIDs []string, skipRoomID string, event interface{}) {
+	if len(userIDs) == 0 {
+		return
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Failed to marshal event: ", err)
+		return
+	}
+	h.Direct <- DirectPayload{
+		UserIDs:    userIDs,
+		SkipRoomID: skipRoomID,
+		Message:    eventBytes,
+	}
+}
+
+// NotifyRoomMembers tells members of a message's room who are connected
+// elsewhere about the new message. Members who muted the room are skipped.
+func (h *Hub) NotifyRoomMembers(msg *models.Message) {
+	recipients, err := services.GetNotificationRecipients(context.Background(), msg.RoomID, msg.SenderID)
+	if err != nil {
+		log.Println("Failed to load notification recipients: ", err)
+		return
+	}
+
+	userIDs := make([]string, 0, len(recipients))
+	for _, id := range recipients {
+		userIDs = append(userIDs, strconv.Itoa(id))
+	}
+	h.SendToUsers(userIDs, msg.RoomID, NotificationPayload{
+		Type:      "notification",
+		RoomID:    msg.RoomID,
+		MessageID: msg.ID.Hex(),
+		SenderID:  msg.SenderID,
+		Preview:   services.PreviewText(msg.Message),
+		Timestamp: msg.Timestamp,
+	})
+}
+
+// NotifyMentions sends a "mention" event to every connection of the users a
+// message mentions, including connections to the message's own room
+func (h *Hub) NotifyMentions(msg *models.Message) {
+	h.NotifyMentioned(msg, msg.Mentions)
+}
+
+// NotifyMentioned sends a message's "mention" event to the given users only,
+// such as those an edit newly mentions
+func (h *Hub) NotifyMentioned(msg *models.Message, mentioned []int) {
+	userIDs := make([]string, 0, len(mentioned))
+	for _, id := range mentioned {
+		userIDs = append(userIDs, strconv.Itoa(id))
+	}
+	h.SendToUsers(userIDs, "", MentionPayload{
+		Type:      "mention",
+		RoomID:    msg.RoomID,
+		MessageID: msg.ID.Hex(),
+		SenderID:  msg.SenderID,
+		Preview:   services.PreviewText(msg.Message),
+		Timestamp: msg.Timestamp,
+	})
+}
+
+// BroadcastPoll sends a poll's current tallies to its room after a vote or close
+func (h *Hub) BroadcastPoll(msg *models.Message) {
+	h.BroadcastEvent(msg.RoomID, PollPayload{
+		Type:      "poll",
+		MessageID: msg.ID.Hex(),
+		RoomID:    msg.RoomID,
+		Poll:      msg.Poll,
+	})
+}
+
+// BroadcastDeletion tells the room that a message was deleted for everyone
+func (h *Hub) BroadcastDeletion(tombstone *models.Message) {
+	h.BroadcastEvent(tombstone.RoomID, DeletionPayload{
+		Type:         "deletion",
+		Scope:        services.DeleteForEveryone,
+		MessageID:    tombstone.ID.Hex(),
+		RoomID:       tombstone.RoomID,
+		SenderID:     tombstone.SenderID,
+		DeletedBy:    tombstone.DeletedBy,
+		DeletedAt:    tombstone.DeletedAt,
+		DeleteReason: tombstone.DeleteReason,
+	})
+}
+
+// BroadcastThreadUpdate sends the parent's new thread summary to the room after a reply is stored
+func (h *Hub) BroadcastThreadUpdate(reply *models.Message) {
+	if reply.ReplyToID == nil {
+		return
+	}
+	parent, err := services.GetMessageByID(context.Background(), *reply.ReplyToID)
+	if err != nil {
+		log.Println("Failed to load thread parent: ", err)
+		return
+	}
+	h.BroadcastEvent(parent.RoomID, ThreadPayload{
+		Type:         "thread",
+		ParentID:     parent.ID.Hex(),
+		ReplyID:      reply.ID.Hex(),
+		RoomID:       parent.RoomID,
+		ReplyCount:   parent.ReplyCount,
+		LastReplyAt:  parent.LastReplyAt,
+		Participants: parent.ThreadParticipants,
+	})
+}
+
+// SyncDraft sends a user's saved draft to all of their connections, so
+// every device shows the same unsent text
+func (h *Hub) SyncDraft(userID int, draft *models.Draft) {
+	payload := DraftPayload{
+		Type:      "draft",
+		RoomID:    draft.RoomID,
+		Content:   draft.Content,
+		UpdatedAt: draft.UpdatedAt,
+	}
+	if draft.ReplyToID != nil {
+		payload.ReplyToID = draft.ReplyToID.Hex()
+	}
+	h.SendToUsers([]string{strconv.Itoa(userID)}, "", payload)
+}
+
+// SyncDraftDeleted tells all of a user's connections that their draft for a room is gone
+func (h *Hub) SyncDraftDeleted(userID int, roomID string) {
+	h.SendToUsers([]string{strconv.Itoa(userID)}, "", DraftPayload{
+		Type:    "draft",
+		RoomID:  roomID,
+		Deleted: true,
+	})
+}
+
+// ClearDraft discards the draft a user had in a room once they send a message there
+func (h *Hub) ClearDraft(userID int, roomID string) {
+	deleted, err := services.DeleteDraft(context.Background(), userID, roomID)
+	if err != nil {
+		log.Println("Failed to clear draft: ", err)
+		return
+	}
+	if deleted {
+		h.SyncDraftDeleted(userID, roomID)
+	}
+}
+
+// SyncStar tells all of a user's connections that they starred or unstarred a
+// message, so every device shows the same bookmarks
+func (h *Hub) SyncStar(userID int, action string, star *models.Star) {
+	h.SendToUsers([]string{strconv.Itoa(userID)}, "", StarPayload{
+		Type:      "star",
+		Action:    action,
+		MessageID: star.MessageID.Hex(),
+		RoomID:    star.RoomID,
+		StarredAt: star.StarredAt,
+	})
+}
+
+// PublishCommandResult broadcasts what a slash command changed: the messages
+// it posted and the room's new settings. Its reply is left to the caller.
+func (h *Hub) PublishCommandResult(roomID string, result *commands.Result) {
+	for _, msg := range result.Messages {
+		h.BroadcastMessage(msg)
+		h.NotifyRoomMembers(msg)
+		h.NotifyMentions(msg)
+	}
+	if result.Room != nil {
+		h.BroadcastEvent(roomID, RoomPayload{Type: "room", Room: result.Room})
+	}
+}
+
 // StoreMessage stores a message in the database
 func (h *Hub) StoreMessage(msg *models.Message) error {
 	return services.InsertMessage(context.Background(), msg)
@@ -1,17 +1,62 @@
 package websocket
 
+import (
+	"time"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+)
+
 type MessagePayload struct {
-	Type           string `json:"type"` // "message", "typing", "reaction", etc.
-	MessageID      string `json:"message_id,omitempty"`
-	RoomID         string `json:"room_id"`
-	SenderID       int    `json:"sender_id"`
-	Content        string `json:"content"`
-	Timestamp      int64  `json:"timestamp,omitempty"`
-	IsGroup        bool   `json:"is_group"`
-	AttachmentURL  string `json:"attachment_url,omitempty"`
-	AttachmentType string `json:"attachment_type,omitempty"`
-	ReplyToID      string `json:"reply_to_id,omitempty"`
-	Message        []byte `json:"-"` // Keep for backward compatibility, will be removed
+	Type            string           `json:"type"` // "message", "typing", "reaction", etc.
+	MessageID       string           `json:"message_id,omitempty"`
+	RoomID          string           `json:"room_id"`
+	SenderID        int              `json:"sender_id"`
+	ClientMsgID     string           `json:"client_msg_id,omitempty"` // the sender's ID for a new message, answered with an "ack" frame
+	Content         string           `json:"content"`
+	Rich            *models.RichText `json:"rich,omitempty"` // set by the server, ignored on incoming frames
+	Timestamp       int64            `json:"timestamp,omitempty"`
+	IsGroup         bool             `json:"is_group"`
+	AttachmentURL   string           `json:"attachment_url,omitempty"`
+	AttachmentType  string           `json:"attachment_type,omitempty"`
+	ReplyToID       string           `json:"reply_to_id,omitempty"`
+	ForwardedFromID string           `json:"forwarded_from_id,omitempty"`
+	Mentions        []int            `json:"mentions,omitempty"` // set by the server, ignored on incoming frames
+	MessageType     string           `json:"message_type,omitempty"`
+	ExpiresAt       *time.Time       `json:"expires_at,omitempty"`
+	Poll            *models.Poll     `json:"poll,omitempty"`
+	OptionIDs       []string         `json:"option_ids,omitempty"` // the options picked in a "vote" frame
+	Message         []byte           `json:"-"`                    // Keep for backward compatibility, will be removed
+
+	// Delivery is the stored message being broadcast, if its delivery should be recorded
+	Delivery *models.Message `json:"-"`
+}
+
+// NewMessagePayload builds the "message" event for a stored message
+func NewMessagePayload(msg *models.Message) MessagePayload {
+	payload := MessagePayload{
+		Type:           "message",
+		MessageID:      msg.ID.Hex(),
+		RoomID:         msg.RoomID,
+		SenderID:       msg.SenderID,
+		ClientMsgID:    msg.ClientMsgID,
+		Content:        msg.Message,
+		Rich:           msg.Rich,
+		Timestamp:      msg.Timestamp,
+		IsGroup:        msg.IsGroup,
+		AttachmentURL:  msg.AttachmentURL,
+		AttachmentType: msg.AttachmentType,
+		Mentions:       msg.Mentions,
+		MessageType:    msg.MessageType,
+		ExpiresAt:      msg.ExpiresAt,
+		Poll:           msg.Poll,
+	}
+	if msg.ReplyToID != nil {
+		payload.ReplyToID = msg.ReplyToID.Hex()
+	}
+	if msg.ForwardedFromID != nil {
+		payload.ForwardedFromID = *msg.ForwardedFromID
+	}
+	return payload
 }
 
 type TypingPayload struct {
@@ -30,3 +75,168 @@ type ReactionPayload struct {
 	Emoji     string `json:"emoji"`
 	Action    string `json:"action"` // "add" or "remove"
 }
+
+type PinPayload struct {
+	Type      string `json:"type"` // always "pin"
+	MessageID string `json:"message_id"`
+	RoomID    string `json:"room_id"`
+	UserID    int    `json:"user_id"`
+	Action    string `json:"action"` // "pin" or "unpin"
+	PinnedAt  int64  `json:"pinned_at,omitempty"`
+}
+
+type NotificationPayload struct {
+	Type      string `json:"type"` // always "notification"
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+	SenderID  int    `json:"sender_id"`
+	Preview   string `json:"preview"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type MentionPayload struct {
+	Type      string `json:"type"` // always "mention"
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+	SenderID  int    `json:"sender_id"`
+	Preview   string `json:"preview"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type EditPayload struct {
+	Type      string           `json:"type"` // always "edit"
+	MessageID string           `json:"message_id"`
+	RoomID    string           `json:"room_id"`
+	SenderID  int              `json:"sender_id"`
+	Content   string           `json:"content"`
+	Rich      *models.RichText `json:"rich,omitempty"`
+	Mentions  []int            `json:"mentions,omitempty"`
+	EditedAt  int64            `json:"edited_at"`
+	EditCount int              `json:"edit_count"`
+}
+
+// NewEditPayload builds the event broadcast after a message is edited
+func NewEditPayload(msg *models.Message) EditPayload {
+	return EditPayload{
+		Type:      "edit",
+		MessageID: msg.ID.Hex(),
+		RoomID:    msg.RoomID,
+		SenderID:  msg.SenderID,
+		Content:   msg.Message,
+		Rich:      msg.Rich,
+		Mentions:  msg.Mentions,
+		EditedAt:  msg.EditedAt,
+		EditCount: msg.EditCount,
+	}
+}
+
+type DeletionPayload struct {
+	Type         string `json:"type"`  // always "deletion"
+	Scope        string `json:"scope"` // "everyone", or "me" when sent to the deleting user's own connections
+	MessageID    string `json:"message_id"`
+	RoomID       string `json:"room_id"`
+	SenderID     int    `json:"sender_id"`
+	DeletedBy    int    `json:"deleted_by"`
+	DeletedAt    int64  `json:"deleted_at,omitempty"`
+	DeleteReason string `json:"delete_reason,omitempty"`
+}
+
+type DraftPayload struct {
+	Type      string `json:"type"` // always "draft"
+	RoomID    string `json:"room_id"`
+	Content   string `json:"content"`
+	ReplyToID string `json:"reply_to_id,omitempty"`
+	UpdatedAt int64  `json:"updated_at,omitempty"`
+	Deleted   bool   `json:"deleted"` // the draft was discarded or sent
+}
+
+type StarPayload struct {
+	Type      string `json:"type"`   // always "star"
+	Action    string `json:"action"` // "star" or "unstar"
+	MessageID string `json:"message_id"`
+	RoomID    string `json:"room_id"`
+	StarredAt int64  `json:"starred_at,omitempty"`
+}
+
+type ExpirePayload struct {
+	Type       string   `json:"type"` // always "expire"
+	RoomID     string   `json:"room_id"`
+	MessageIDs []string `json:"message_ids"`
+}
+
+type PollPayload struct {
+	Type      string       `json:"type"` // always "poll"
+	MessageID string       `json:"message_id"`
+	RoomID    string       `json:"room_id"`
+	Poll      *models.Poll `json:"poll"` // current tallies
+}
+
+type PreviewPayload struct {
+	Type      string               `json:"type"` // always "preview"
+	MessageID string               `json:"message_id"`
+	RoomID    string               `json:"room_id"`
+	Previews  []models.LinkPreview `json:"previews"`
+}
+
+type CommandPayload struct {
+	Type    string `json:"type"` // always "command"
+	RoomID  string `json:"room_id"`
+	Command string `json:"command"`
+	Text    string `json:"text"` // the command's reply, shown only to the user who ran it
+}
+
+type RoomPayload struct {
+	Type string       `json:"type"` // always "room"
+	Room *models.Room `json:"room"` // the room after its settings changed
+}
+
+type ThreadPayload struct {
+	Type         string `json:"type"` // always "thread"
+	ParentID     string `json:"parent_id"`
+	ReplyID      string `json:"reply_id"`
+	RoomID       string `json:"room_id"`
+	ReplyCount   int    `json:"reply_count"`
+	LastReplyAt  int64  `json:"last_reply_at"`
+	Participants []int  `json:"participants"`
+}
+
+type ReceiptPayload struct {
+	Type      string `json:"type"`       // always "receipt"
+	Status    string `json:"status"`     // "delivered" or "read"
+	MessageID string `json:"message_id"` // for "read", everything up to this message was read
+	RoomID    string `json:"room_id"`
+	UserID    int    `json:"user_id,omitempty"`
+	UserIDs   []int  `json:"user_ids,omitempty"` // group deliveries are reported for all recipients at once
+}
+
+type ErrorPayload struct {
+	Type        string `json:"type"` // always "error"
+	Error       string `json:"error"`
+	Code        string `json:"code,omitempty"`
+	RoomID      string `json:"room_id,omitempty"`
+	ClientMsgID string `json:"client_msg_id,omitempty"` // the rejected message, when the client gave it an ID
+	RetryAfter  int64  `json:"retry_after,omitempty"`   // seconds
+	Limit       int    `json:"limit,omitempty"`         // the content limit that was exceeded
+}
+
+// AckPayload confirms to the sender's connection that a message is stored
+type AckPayload struct {
+	Type        string `json:"type"` // always "ack"
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	MessageID   string `json:"message_id"`
+	RoomID      string `json:"room_id"`
+	Timestamp   int64  `json:"timestamp"`
+	Duplicate   bool   `json:"duplicate"` // a resend; the original was stored earlier and is not broadcast again
+}
+
+// NewAckPayload builds the "ack" frame for a stored message
+func NewAckPayload(msg *models.Message, duplicate bool) AckPayload {
+	return AckPayload{
+		Type:        "ack",
+		ClientMsgID: msg.ClientMsgID,
+		MessageID:   msg.ID.Hex(),
+		RoomID:      msg.RoomID,
+		Timestamp:   msg.Timestamp,
+		Duplicate:   duplicate,
+	}
+}
@@ -0,0 +1,47 @@
+package websocket
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAckPayloadJSON(t *testing.T) {
+	id := primitive.NewObjectID()
+	msg := &models.Message{ID: id, RoomID: "room_1", ClientMsgID: "c-1", Timestamp: 1700000000}
+
+	data, err := json.Marshal(NewAckPayload(msg, true))
+	if err != nil {
+		t.Fatalf("Marshal error = %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal error = %v", err)
+	}
+	want := map[string]interface{}{
+		"type":          "ack",
+		"client_msg_id": "c-1",
+		"message_id":    id.Hex(),
+		"room_id":       "room_1",
+		"timestamp":     float64(1700000000),
+		"duplicate":     true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ack = %v, want %v", got, want)
+	}
+
+	// Messages sent without a client ID are acknowledged without one
+	msg.ClientMsgID = ""
+	data, _ = json.Marshal(NewAckPayload(msg, false))
+	var withoutID map[string]interface{}
+	if err := json.Unmarshal(data, &withoutID); err != nil {
+		t.Fatalf("Unmarshal error = %v", err)
+	}
+	if _, ok := withoutID["client_msg_id"]; ok {
+		t.Errorf("ack without client ID = %s", data)
+	}
+}
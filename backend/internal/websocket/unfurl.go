@@ -0,0 +1,83 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"go-react-chat/kalpesh-vala/github.com/internal/unfurl"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"go-react-chat/kalpesh-vala/github.com/services"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// unfurlQueueSize bounds how many messages may wait for previews. When the
+// queue is full new messages simply go without previews.
+const unfurlQueueSize = 256
+
+// unfurlJob is a copy of what the unfurler needs from a message, so the
+// message itself is not shared with the worker goroutines
+type unfurlJob struct {
+	MessageID primitive.ObjectID
+	RoomID    string
+	Content   string
+	Rich      *models.RichText
+}
+
+// QueueUnfurl schedules previews for the links in a stored or edited message
+func (h *Hub) QueueUnfurl(msg *models.Message) {
+	if msg.MessageType == models.MessageTypeSystem || len(unfurl.Links(msg.Rich)) == 0 {
+		return
+	}
+	select {
+	case h.unfurls <- unfurlJob{MessageID: msg.ID, RoomID: msg.RoomID, Content: msg.Message, Rich: msg.Rich}:
+	default:
+		log.Println("Link preview queue is full, skipping message", msg.ID.Hex())
+	}
+}
+
+// RunUnfurler builds previews for queued messages with the given number of
+// workers until ctx is cancelled. Each stored preview is broadcast to the
+// message's room as a "preview" event.
+func (h *Hub) RunUnfurler(ctx context.Context, u *unfurl.Unfurler, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-h.unfurls:
+					h.unfurlMessage(ctx, u, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// unfurlMessage stores a message's previews and tells its room about them
+func (h *Hub) unfurlMessage(ctx context.Context, u *unfurl.Unfurler, job unfurlJob) {
+	previews := u.Previews(ctx, job.Rich)
+	if len(previews) == 0 {
+		return
+	}
+	stored, err := services.SetLinkPreviews(ctx, job.MessageID, job.Content, previews)
+	if err != nil {
+		log.Println("Failed to store link previews: ", err)
+		return
+	}
+	if !stored {
+		// Edited or deleted while the links were fetched
+		return
+	}
+	h.BroadcastEvent(job.RoomID, PreviewPayload{
+		Type:      "preview",
+		MessageID: job.MessageID.Hex(),
+		RoomID:    job.RoomID,
+		Previews:  previews,
+	})
+}
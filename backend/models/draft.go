@@ -0,0 +1,16 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Draft is unsent text a user left in a room's composer, kept on the server
+// so it follows them between devices
+type Draft struct {
+	ID        primitive.ObjectID  `json:"-" bson:"_id,omitempty"`
+	UserID    int                 `json:"-" bson:"user_id"`
+	RoomID    string              `json:"room_id" bson:"room_id"`
+	Content   string              `json:"content" bson:"content"`
+	ReplyToID *primitive.ObjectID `json:"reply_to_id,omitempty" bson:"reply_to_id,omitempty"`
+	UpdatedAt int64               `json:"updated_at" bson:"updated_at"`
+}
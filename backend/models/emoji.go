@@ -0,0 +1,18 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CustomEmoji is an uploaded emoji image, used as :shortcode: in reactions and messages
+type CustomEmoji struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Shortcode   string             `json:"shortcode" bson:"shortcode"` // without the surrounding colons
+	ContentType string             `json:"content_type" bson:"content_type"`
+	Data        []byte             `json:"-" bson:"data,omitempty"`
+	Size        int                `json:"size" bson:"size"`
+	CreatedBy   int                `json:"created_by" bson:"created_by"`
+	CreatedAt   int64              `json:"created_at" bson:"created_at"`
+	URL         string             `json:"url" bson:"-"`
+	Version     int64              `json:"version,omitempty" bson:"-"` // emoji version after this upload
+}
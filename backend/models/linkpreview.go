@@ -0,0 +1,16 @@
+package models
+
+// LinkPreview describes a page linked from a message, gathered from its
+// OpenGraph tags and oEmbed data
+type LinkPreview struct {
+	URL         string `json:"url" bson:"url"` // the link as written in the message
+	Title       string `json:"title,omitempty" bson:"title,omitempty"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty" bson:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty" bson:"site_name,omitempty"`
+}
+
+// IsEmpty reports whether the page had nothing worth showing
+func (p *LinkPreview) IsEmpty() bool {
+	return p.Title == "" && p.Description == "" && p.ImageURL == ""
+}
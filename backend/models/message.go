@@ -1,14 +1,36 @@
 package models
 
 import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Message delivery statuses. Only messages in private rooms move past "sent";
+// group rooms report per-member receipts instead.
+const (
+	MessageStatusSent      = "sent"
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+)
+
+// Message types. Regular messages leave the type empty.
+const (
+	MessageTypeSystem = "system" // posted by the server, e.g. when room settings change
+	MessageTypePoll   = "poll"   // carries a Poll; the message content is the question
+	MessageTypeAction = "action" // sent with /me; clients show it after the sender's name
+)
+
 type Message struct {
 	ID              primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
 	RoomID          string              `json:"room_id" bson:"room_id"`
 	SenderID        int                 `json:"sender_id" bson:"sender_id"`
+	ClientMsgID     string              `json:"client_msg_id,omitempty" bson:"client_msg_id,omitempty"` // chosen by the sender's client so resends are not stored twice
 	Message         string              `json:"message" bson:"message"`
+	Rich            *RichText           `json:"rich,omitempty" bson:"rich,omitempty"` // Message parsed as markdown
 	Timestamp       int64               `json:"timestamp" bson:"timestamp"`
 	IsGroup         bool                `json:"is_group" bson:"is_group"`
 	Status          string              `json:"status" bson:"status"`
@@ -17,5 +39,225 @@ type Message struct {
 	ReplyToID       *primitive.ObjectID `json:"reply_to_id,omitempty" bson:"reply_to_id,omitempty"`
 	ForwardedFromID *string             `json:"forwarded_from_id,omitempty" bson:"forwarded_from_id,omitempty"`
 	Deleted         bool                `json:"deleted" bson:"deleted"`
-	Reactions       map[string][]string `json:"reactions,omitempty" bson:"reactions,omitempty"`
+	Pinned          bool                `json:"pinned,omitempty" bson:"pinned,omitempty"`
+	PinnedBy        int                 `json:"pinned_by,omitempty" bson:"pinned_by,omitempty"`
+	PinnedAt        int64               `json:"pinned_at,omitempty" bson:"pinned_at,omitempty"`
+	EditedAt        int64               `json:"edited_at,omitempty" bson:"edited_at,omitempty"`
+	EditCount       int                 `json:"edit_count,omitempty" bson:"edit_count,omitempty"`
+	Mentions        []int               `json:"mentions,omitempty" bson:"mentions,omitempty"` // user IDs notified by @username, @here or @channel
+	MessageType     string              `json:"message_type,omitempty" bson:"message_type,omitempty"`
+	ExpiresAt       *time.Time          `json:"expires_at,omitempty" bson:"expires_at,omitempty"` // set in rooms with disappearing messages
+	Poll            *Poll               `json:"poll,omitempty" bson:"poll,omitempty"`
+	Previews        []LinkPreview       `json:"previews,omitempty" bson:"previews,omitempty"` // filled in shortly after sending
+
+	// Thread summary, kept on the parent message
+	ReplyCount         int   `json:"reply_count,omitempty" bson:"reply_count,omitempty"`
+	LastReplyAt        int64 `json:"last_reply_at,omitempty" bson:"last_reply_at,omitempty"`
+	ThreadParticipants []int `json:"thread_participants,omitempty" bson:"thread_participants,omitempty"`
+
+	// Deletion. A message deleted for everyone keeps only these and its place
+	// in the room and thread; its content is removed from the database.
+	DeletedAt    int64  `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy    int    `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+	DeleteReason string `json:"delete_reason,omitempty" bson:"delete_reason,omitempty"` // given when a moderator removes someone else's message
+	// HiddenFor lists the users who deleted the message for themselves only
+	HiddenFor []int `json:"-" bson:"hidden_for,omitempty"`
+
+	// UserReactions maps a user ID to their one reaction, so a reaction can be
+	// set, changed or removed with a single update. Clients see it grouped by emoji.
+	UserReactions map[string]string `json:"-" bson:"user_reactions,omitempty"`
+}
+
+// ReactionGroups lists the user IDs that reacted with each emoji
+func (m *Message) ReactionGroups() map[string][]string {
+	if len(m.UserReactions) == 0 {
+		return nil
+	}
+	groups := map[string][]string{}
+	for userID, emoji := range m.UserReactions {
+		groups[emoji] = append(groups[emoji], userID)
+	}
+	for _, users := range groups {
+		sort.Strings(users)
+	}
+	return groups
+}
+
+// MarshalJSON adds the reactions grouped by emoji, the shape clients expect
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	return json.Marshal(struct {
+		message
+		Reactions map[string][]string `json:"reactions,omitempty"`
+	}{message(m), m.ReactionGroups()})
+}
+
+// ReactionCount is how many users reacted to a message with one emoji
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+// Reactor is one user's reaction to a message
+type Reactor struct {
+	UserID int    `json:"user_id"`
+	Emoji  string `json:"emoji"`
+}
+
+// Poll is the question, options and votes of a poll message
+type Poll struct {
+	Question       string       `bson:"question"`
+	Options        []PollOption `bson:"options"`
+	MultipleChoice bool         `bson:"multiple_choice"`
+	Anonymous      bool         `bson:"anonymous"`
+	CreatedBy      int          `bson:"created_by"`
+	ClosesAt       int64        `bson:"closes_at,omitempty"` // unix time the poll closes by itself, 0 for never
+	ClosedAt       int64        `bson:"closed_at,omitempty"` // unix time the poll was closed
+	// Votes maps a voter's user ID to the option IDs they picked
+	Votes map[string][]string `bson:"votes,omitempty"`
+}
+
+// PollOption is one answer of a poll
+type PollOption struct {
+	ID   string `json:"id" bson:"id"`
+	Text string `json:"text" bson:"text"`
+}
+
+// IsClosed reports whether the poll stopped accepting votes at the given unix time
+func (p *Poll) IsClosed(now int64) bool {
+	return p.ClosedAt > 0 || (p.ClosesAt > 0 && p.ClosesAt <= now)
+}
+
+// pollResult is how one option is shown to clients
+type pollResult struct {
+	ID     string `json:"id"`
+	Text   string `json:"text"`
+	Votes  int    `json:"votes"`
+	Voters []int  `json:"voters,omitempty"`
+}
+
+// MarshalJSON shows tallies instead of the raw votes. Voters are listed only
+// for public polls, so anonymous votes never leave the server.
+func (p Poll) MarshalJSON() ([]byte, error) {
+	results := make([]pollResult, len(p.Options))
+	index := make(map[string]int, len(p.Options))
+	for i, opt := range p.Options {
+		results[i] = pollResult{ID: opt.ID, Text: opt.Text}
+		index[opt.ID] = i
+	}
+	for voter, optionIDs := range p.Votes {
+		userID, _ := strconv.Atoi(voter)
+		for _, id := range optionIDs {
+			if i, ok := index[id]; ok {
+				results[i].Votes++
+				if !p.Anonymous {
+					results[i].Voters = append(results[i].Voters, userID)
+				}
+			}
+		}
+	}
+	for i := range results {
+		sort.Ints(results[i].Voters)
+	}
+
+	return json.Marshal(struct {
+		Question       string       `json:"question"`
+		Options        []pollResult `json:"options"`
+		MultipleChoice bool         `json:"multiple_choice"`
+		Anonymous      bool         `json:"anonymous"`
+		CreatedBy      int          `json:"created_by"`
+		ClosesAt       int64        `json:"closes_at,omitempty"`
+		Closed         bool         `json:"closed"`
+		TotalVoters    int          `json:"total_voters"`
+	}{
+		Question:       p.Question,
+		Options:        results,
+		MultipleChoice: p.MultipleChoice,
+		Anonymous:      p.Anonymous,
+		CreatedBy:      p.CreatedBy,
+		ClosesAt:       p.ClosesAt,
+		Closed:         p.IsClosed(time.Now().Unix()),
+		TotalVoters:    len(p.Votes),
+	})
+}
+
+// MessageEdit keeps a previous version of an edited message
+type MessageEdit struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	MessageID       primitive.ObjectID `json:"message_id" bson:"message_id"`
+	RoomID          string             `json:"room_id" bson:"room_id"`
+	EditorID        int                `json:"editor_id" bson:"editor_id"`
+	Version         int                `json:"version" bson:"version"` // edit count before this edit, 0 is the original
+	PreviousContent string             `json:"previous_content" bson:"previous_content"`
+	EditedAt        int64              `json:"edited_at" bson:"edited_at"`
+}
+
+// Mention is one entry of a user's mentions inbox. It is marked read once
+// the user's read position in the room passes the message.
+type Mention struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    int                `json:"user_id" bson:"user_id"`
+	RoomID    string             `json:"room_id" bson:"room_id"`
+	MessageID primitive.ObjectID `json:"message_id" bson:"message_id"`
+	SenderID  int                `json:"sender_id" bson:"sender_id"`
+	Preview   string             `json:"preview" bson:"preview"`
+	Timestamp int64              `json:"timestamp" bson:"timestamp"`
+	Read      bool               `json:"read" bson:"read"`
+}
+
+// Scheduled message states. A message moves from pending to sending when a
+// dispatcher claims it, then to sent or failed; only pending ones can change.
+const (
+	ScheduledStatusPending   = "pending"
+	ScheduledStatusSending   = "sending"
+	ScheduledStatusSent      = "sent"
+	ScheduledStatusFailed    = "failed"
+	ScheduledStatusCancelled = "cancelled"
+)
+
+// ScheduledMessage is a message waiting to be sent at SendAt
+type ScheduledMessage struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	RoomID         string              `json:"room_id" bson:"room_id"`
+	SenderID       int                 `json:"sender_id" bson:"sender_id"`
+	Message        string              `json:"message" bson:"message"`
+	IsGroup        bool                `json:"is_group" bson:"is_group"`
+	AttachmentURL  string              `json:"attachment_url,omitempty" bson:"attachment_url,omitempty"`
+	AttachmentType string              `json:"attachment_type,omitempty" bson:"attachment_type,omitempty"`
+	ReplyToID      *primitive.ObjectID `json:"reply_to_id,omitempty" bson:"reply_to_id,omitempty"`
+	SendAt         int64               `json:"send_at" bson:"send_at"`
+	Status         string              `json:"status" bson:"status"`
+	Error          string              `json:"error,omitempty" bson:"error,omitempty"`
+	// ID the message is stored under; assigned on the first claim so a retry can never store it twice
+	MessageID    *primitive.ObjectID `json:"message_id,omitempty" bson:"message_id,omitempty"`
+	ClaimedBy    string              `json:"-" bson:"claimed_by,omitempty"`
+	ClaimedUntil int64               `json:"-" bson:"claimed_until,omitempty"`
+	CreatedAt    int64               `json:"created_at" bson:"created_at"`
+	UpdatedAt    int64               `json:"updated_at" bson:"updated_at"`
+}
+
+// MessagePage is one page of a room's history, oldest message first.
+// PrevCursor and NextCursor are set when older or newer messages exist.
+type MessagePage struct {
+	Messages      []Message `json:"messages"`
+	PrevCursor    string    `json:"prev_cursor,omitempty"`
+	NextCursor    string    `json:"next_cursor,omitempty"`
+	HasMoreBefore bool      `json:"has_more_before"`
+	HasMoreAfter  bool      `json:"has_more_after"`
+}
+
+// MessageReceipts lists which room members have received and read a message
+type MessageReceipts struct {
+	MessageID   string `json:"message_id"`
+	DeliveredTo []int  `json:"delivered_to"`
+	ReadBy      []int  `json:"read_by"`
+}
+
+// SearchResult is one message matched by a full-text search. Highlights are
+// [start, end) character offsets of the matched words within Snippet.
+type SearchResult struct {
+	Message    Message  `json:"message"`
+	Snippet    string   `json:"snippet"`
+	Highlights [][2]int `json:"highlights"`
+	Score      float64  `json:"score"`
 }
@@ -0,0 +1,50 @@
+package models
+
+// Rich text block types
+const (
+	BlockParagraph = "paragraph"
+	BlockCode      = "code_block"
+	BlockQuote     = "quote"
+	BlockList      = "list"
+)
+
+// Rich text inline types
+const (
+	InlineText    = "text"
+	InlineBold    = "bold"
+	InlineItalic  = "italic"
+	InlineCode    = "code"
+	InlineLink    = "link"
+	InlineMention = "mention"
+	InlineEmoji   = "emoji"
+)
+
+// RichText is message content parsed from the supported markdown subset.
+// Every string in it is plain text; clients must never render it as HTML.
+type RichText struct {
+	Blocks []RichBlock `json:"blocks" bson:"blocks"`
+}
+
+// RichBlock is one block of rich text. Which fields are set depends on Type:
+// paragraphs have Inlines, code blocks Text and Language, quotes nested
+// Blocks, and lists Items.
+type RichBlock struct {
+	Type     string         `json:"type" bson:"type"`
+	Inlines  []RichInline   `json:"inlines,omitempty" bson:"inlines,omitempty"`
+	Text     string         `json:"text,omitempty" bson:"text,omitempty"`
+	Language string         `json:"language,omitempty" bson:"language,omitempty"`
+	Blocks   []RichBlock    `json:"blocks,omitempty" bson:"blocks,omitempty"`
+	Ordered  bool           `json:"ordered,omitempty" bson:"ordered,omitempty"`
+	Items    [][]RichInline `json:"items,omitempty" bson:"items,omitempty"`
+}
+
+// RichInline is a run of text inside a block. Text, code, mention and emoji
+// nodes carry Text (the username for mentions, the shortcode for emoji);
+// bold, italic and link nodes carry Children. Links carry their URL, and
+// emoji the URL of their image.
+type RichInline struct {
+	Type     string       `json:"type" bson:"type"`
+	Text     string       `json:"text,omitempty" bson:"text,omitempty"`
+	URL      string       `json:"url,omitempty" bson:"url,omitempty"`
+	Children []RichInline `json:"children,omitempty" bson:"children,omitempty"`
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Room visibility values
+const (
+	RoomVisibilityPublic   = "public"   // listed in the directory, readable and joinable by anyone
+	RoomVisibilityUnlisted = "unlisted" // hidden from the directory, joinable by anyone who knows the ID
+	RoomVisibilityPrivate  = "private"  // members only
+)
+
+// Room member roles
+const (
+	RoomRoleAdmin  = "admin"
+	RoomRoleMember = "member"
+)
+
+// Room keeps the denormalized state needed to list conversations quickly.
+// The document ID is the same string room ID used by messages and sockets.
+type Room struct {
+	ID           string          `json:"id" bson:"_id"`
+	Name         string          `json:"name,omitempty" bson:"name,omitempty"`
+	Topic        string          `json:"topic,omitempty" bson:"topic,omitempty"`
+	Visibility   string          `json:"visibility" bson:"visibility"`
+	IsGroup      bool            `json:"is_group" bson:"is_group"`
+	CreatedBy    int             `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	MemberCount  int64           `json:"member_count" bson:"member_count"`
+	PinnedCount  int             `json:"pinned_count" bson:"pinned_count"`
+	Policy       RoomPolicy      `json:"policy" bson:"policy"`
+	LastMessage  *MessagePreview `json:"last_message,omitempty" bson:"last_message,omitempty"`
+	LastActivity int64           `json:"last_activity" bson:"last_activity"`
+	CreatedAt    int64           `json:"created_at" bson:"created_at"`
+}
+
+// RoomPolicy holds the posting rules enforced for a room
+type RoomPolicy struct {
+	SlowModeSeconds     int  `json:"slow_mode_seconds" bson:"slow_mode_seconds"`         // minimum seconds between one user's messages, 0 disables
+	AnnouncementOnly    bool `json:"announcement_only" bson:"announcement_only"`         // only admins may post
+	AttachmentsDisabled bool `json:"attachments_disabled" bson:"attachments_disabled"`   // reject messages with attachments
+	SendersCanPin       bool `json:"senders_can_pin" bson:"senders_can_pin"`             // let members pin their own messages, not only admins
+	EditWindowSeconds   int  `json:"edit_window_seconds" bson:"edit_window_seconds"`     // how long after sending a message can be edited, 0 means no limit
+	MessageTTLSeconds   int  `json:"message_ttl_seconds" bson:"message_ttl_seconds"`     // disappearing messages are removed this long after sending, 0 keeps them
+	DeleteWindowSeconds int  `json:"delete_window_seconds" bson:"delete_window_seconds"` // how long after sending a sender can delete for everyone, 0 means no limit
+}
+
+// IsPublic reports whether non-members may read and join the room
+func (r *Room) IsPublic() bool {
+	return r.Visibility == RoomVisibilityPublic
+}
+
+// IsJoinable reports whether users may add themselves to the room
+func (r *Room) IsJoinable() bool {
+	return r.Visibility == RoomVisibilityPublic || r.Visibility == RoomVisibilityUnlisted
+}
+
+// ValidRoomVisibility reports whether v is a known visibility value
+func ValidRoomVisibility(v string) bool {
+	switch v {
+	case RoomVisibilityPublic, RoomVisibilityUnlisted, RoomVisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// MessagePreview is a short copy of the latest message in a room
+type MessagePreview struct {
+	MessageID     primitive.ObjectID `json:"message_id" bson:"message_id"`
+	SenderID      int                `json:"sender_id" bson:"sender_id"`
+	Content       string             `json:"content" bson:"content"`
+	Timestamp     int64              `json:"timestamp" bson:"timestamp"`
+	HasAttachment bool               `json:"has_attachment" bson:"has_attachment"`
+}
+
+// RoomMember links a user to a room and tracks their read position
+type RoomMember struct {
+	ID                primitive.ObjectID  `json:"-" bson:"_id,omitempty"`
+	RoomID            string              `json:"room_id" bson:"room_id"`
+	UserID            int                 `json:"user_id" bson:"user_id"`
+	Role              string              `json:"role" bson:"role"`
+	UnreadCount       int64               `json:"unread_count" bson:"unread_count"`
+	LastReadMessageID *primitive.ObjectID `json:"last_read_message_id,omitempty" bson:"last_read_message_id,omitempty"`
+	LastReadAt        int64               `json:"last_read_at,omitempty" bson:"last_read_at,omitempty"`
+	// Newest message handed to one of the member's connections
+	LastDeliveredMessageID *primitive.ObjectID `json:"last_delivered_message_id,omitempty" bson:"last_delivered_message_id,omitempty"`
+	JoinedAt               int64               `json:"joined_at" bson:"joined_at"`
+
+	// Per-user preferences for organizing the conversation list
+	Archived   bool  `json:"archived" bson:"archived,omitempty"`
+	MutedUntil int64 `json:"muted_until,omitempty" bson:"muted_until,omitempty"`
+	Favorite   bool  `json:"favorite" bson:"favorite,omitempty"`
+	Position   int   `json:"position,omitempty" bson:"position,omitempty"` // manual sort order, 0 when unset
+}
+
+// IsMuted reports whether the member has muted the room at the given unix time
+func (m *RoomMember) IsMuted(now int64) bool {
+	return m.MutedUntil > now
+}
+
+// Conversation is one entry of a user's conversation list
+type Conversation struct {
+	RoomID              string `json:"room_id"`
+	RoomName            string `json:"room_name,omitempty"`
+	IsGroup             bool   `json:"is_group"`
+	PartnerID           int    `json:"partner_id,omitempty"`
+	LastMessageID       string `json:"last_message_id,omitempty"`
+	LastMessage         string `json:"last_message"`
+	LastMessageSenderID int    `json:"last_message_sender_id,omitempty"`
+	LastMessageTime     int64  `json:"last_message_time"`
+	UnreadCount         int64  `json:"unread_count"`
+	Archived            bool   `json:"archived"`
+	Muted               bool   `json:"muted"`
+	MutedUntil          int64  `json:"muted_until,omitempty"`
+	Favorite            bool   `json:"favorite"`
+	Position            int    `json:"position,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Star is a message a user bookmarked for later
+type Star struct {
+	ID        primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	UserID    int                `json:"-" bson:"user_id"`
+	MessageID primitive.ObjectID `json:"message_id" bson:"message_id"`
+	RoomID    string             `json:"room_id" bson:"room_id"`
+	StarredAt int64              `json:"starred_at" bson:"starred_at"`
+}
+
+// StarredMessage is one entry of a user's starred list
+type StarredMessage struct {
+	Message   Message `json:"message" bson:"message"`
+	StarredAt int64   `json:"starred_at" bson:"starred_at"`
+}
@@ -1,9 +1,12 @@
 package routes
 
 import (
+	"context"
 	"database/sql"
 	"go-react-chat/kalpesh-vala/github.com/controllers"
 	"go-react-chat/kalpesh-vala/github.com/internal/middleware"
+	"go-react-chat/kalpesh-vala/github.com/internal/scheduler"
+	"go-react-chat/kalpesh-vala/github.com/internal/unfurl"
 	ws "go-react-chat/kalpesh-vala/github.com/internal/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -17,6 +20,15 @@ func SetUpRoutes(r *gin.Engine, db *sql.DB) {
 	// Set the global hub for message controller
 	controllers.SetGlobalHub(hub)
 
+	// Send scheduled messages as they fall due
+	go scheduler.NewDispatcher(hub).Run(context.Background())
+	// Remove disappearing messages as they expire
+	go scheduler.NewExpirySweeper(hub).Run(context.Background())
+	// Record messages as delivered once they reach recipients' connections
+	go hub.RunDeliveryRecorder(context.Background())
+	// Fetch link previews for new and edited messages
+	go hub.RunUnfurler(context.Background(), unfurl.New(unfurl.NewHTTPFetcher()), 4)
+
 	//Auth routes
 	r.POST("/register", controllers.Register(db))
 	r.POST("/login", controllers.Login(db))
@@ -38,11 +50,69 @@ func SetUpRoutes(r *gin.Engine, db *sql.DB) {
 	r.GET("/user-status", controllers.GetUserStatus)
 
 	// Message routes
-	r.POST("/message", controllers.SendMessage)
-	r.GET("/messages", controllers.GetChatHistory)
-	r.POST("/message/reaction/add", controllers.AddReactionHandler)
-	r.POST("/message/reaction/remove", controllers.RemoveReactionHandler)
-	r.POST("/message/delete", controllers.DeleteMessageHandler)
+	r.POST("/message", middleware.AuthMiddleware(), controllers.SendMessage)
+	r.GET("/messages", middleware.AuthMiddleware(), controllers.GetChatHistory)
+	r.GET("/messages/:id/thread", middleware.AuthMiddleware(), controllers.GetThreadHandler)
+	r.POST("/message/reaction/add", middleware.AuthMiddleware(), controllers.AddReactionHandler)
+	r.POST("/message/reaction/remove", middleware.AuthMiddleware(), controllers.RemoveReactionHandler)
+	r.GET("/message/:id/reactions", middleware.AuthMiddleware(), controllers.GetReactionSummaryHandler)
+	r.POST("/message/delete", middleware.AuthMiddleware(), controllers.DeleteMessageHandler)
+	r.POST("/message/forward", middleware.AuthMiddleware(), controllers.ForwardMessageHandler)
+	r.POST("/message/schedule", middleware.AuthMiddleware(), controllers.ScheduleMessageHandler)
+	r.GET("/message/schedule", middleware.AuthMiddleware(), controllers.GetScheduledMessagesHandler)
+	r.PATCH("/message/schedule/:id", middleware.AuthMiddleware(), controllers.UpdateScheduledMessageHandler)
+	r.DELETE("/message/schedule/:id", middleware.AuthMiddleware(), controllers.CancelScheduledMessageHandler)
+	r.PATCH("/message/:id", middleware.AuthMiddleware(), controllers.EditMessageHandler)
+	r.GET("/message/:id/edits", middleware.AuthMiddleware(), controllers.GetMessageEditsHandler)
+	r.GET("/message/:id/receipts", middleware.AuthMiddleware(), controllers.GetMessageReceiptsHandler)
+	r.POST("/message/:id/star", middleware.AuthMiddleware(), controllers.StarMessageHandler)
+	r.DELETE("/message/:id/star", middleware.AuthMiddleware(), controllers.UnstarMessageHandler)
+
+	// Slash command routes (protected)
+	r.GET("/commands", middleware.AuthMiddleware(), controllers.ListCommandsHandler)
+
+	// Search routes (protected)
+	r.GET("/search/messages", middleware.AuthMiddleware(), controllers.SearchMessagesHandler)
+
+	// Custom emoji routes; images and the list are public so clients can cache them
+	r.GET("/emoji", controllers.ListEmojiHandler)
+	r.POST("/emoji", middleware.AuthMiddleware(), controllers.UploadEmojiHandler)
+	r.GET("/emoji/:shortcode/image", controllers.GetEmojiImageHandler)
+	r.DELETE("/emoji/:shortcode", middleware.AuthMiddleware(), controllers.DeleteEmojiHandler)
+
+	// Poll routes (protected)
+	r.POST("/polls", middleware.AuthMiddleware(), controllers.CreatePollHandler)
+	r.POST("/polls/:id/vote", middleware.AuthMiddleware(), controllers.VotePollHandler)
+	r.DELETE("/polls/:id/vote", middleware.AuthMiddleware(), controllers.VotePollHandler)
+	r.POST("/polls/:id/close", middleware.AuthMiddleware(), controllers.ClosePollHandler)
+
+	// Draft routes (protected)
+	r.GET("/drafts", middleware.AuthMiddleware(), controllers.ListDraftsHandler)
+	r.GET("/drafts/:room_id", middleware.AuthMiddleware(), controllers.GetDraftHandler)
+	r.PUT("/drafts/:room_id", middleware.AuthMiddleware(), controllers.SaveDraftHandler)
+	r.DELETE("/drafts/:room_id", middleware.AuthMiddleware(), controllers.DeleteDraftHandler)
+
+	// Starred message routes (protected)
+	r.GET("/starred", middleware.AuthMiddleware(), controllers.GetStarredMessagesHandler)
+
+	// Mention routes (protected)
+	r.GET("/mentions", middleware.AuthMiddleware(), controllers.GetMentionsHandler)
+
+	// Conversation routes (protected)
+	r.GET("/conversations", middleware.AuthMiddleware(), controllers.GetConversations)
+	r.POST("/conversations/:room_id/read", middleware.AuthMiddleware(), controllers.MarkConversationRead)
+	r.PATCH("/conversations/:room_id/preferences", middleware.AuthMiddleware(), controllers.UpdateConversationPreferences)
+
+	// Room routes
+	r.GET("/rooms/directory", controllers.GetRoomDirectory)
+	r.POST("/rooms", middleware.AuthMiddleware(), controllers.CreateRoom)
+	r.GET("/rooms/:id", middleware.AuthMiddleware(), controllers.GetRoom)
+	r.PATCH("/rooms/:id", middleware.AuthMiddleware(), controllers.UpdateRoom)
+	r.POST("/rooms/:id/join", middleware.AuthMiddleware(), controllers.JoinRoom)
+	r.POST("/rooms/:id/leave", middleware.AuthMiddleware(), controllers.LeaveRoom)
+	r.GET("/rooms/:id/pins", middleware.AuthMiddleware(), controllers.GetPinnedMessages)
+	r.POST("/rooms/:id/pins", middleware.AuthMiddleware(), controllers.PinMessage)
+	r.DELETE("/rooms/:id/pins/:message_id", middleware.AuthMiddleware(), controllers.UnpinMessage)
 
 	r.GET("/ws", ws.ServeWs(hub))
 
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/internal/markdown"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Content violation codes
+const (
+	ContentInvalidUTF8           = "invalid_utf8"
+	ContentTooLong               = "message_too_long"
+	ContentTooManyAttachments    = "too_many_attachments"
+	ContentInvalidAttachmentURL  = "invalid_attachment_url"
+	ContentInvalidAttachmentType = "invalid_attachment_type"
+)
+
+// ContentError describes message content rejected by the server's content limits
+type ContentError struct {
+	Code    string
+	Message string
+	Limit   int // the limit that was exceeded, for length and count violations
+}
+
+func (e *ContentError) Error() string {
+	return e.Message
+}
+
+// ContentLimits are the server-wide limits on what clients may send. They are
+// read from the environment the first time they are needed.
+type ContentLimits struct {
+	MaxMessageLength  int      // characters of message text
+	MaxAttachments    int      // per message; a message holds at most one today, so 0 turns attachments off
+	AttachmentSchemes []string // allowed attachment URL schemes, lower case
+	MaxPayloadBytes   int64    // largest message request body or WebSocket frame read from a client
+}
+
+// Content limit defaults, used when the environment does not set them
+const (
+	DefaultMaxMessageLength = 4000
+	DefaultMaxAttachments   = 1
+	DefaultMaxPayloadBytes  = 64 << 10
+)
+
+// Fixed attachment field limits
+const (
+	maxAttachmentURLLength  = 2048
+	maxAttachmentTypeLength = 100
+)
+
+// attachmentKinds are the accepted attachment types, either alone (like
+// "image") or as the top level of a media type (like "image/png")
+var attachmentKinds = map[string]bool{
+	"image":       true,
+	"video":       true,
+	"audio":       true,
+	"text":        true,
+	"application": true,
+	"file":        true,
+}
+
+var (
+	contentLimits     ContentLimits
+	contentLimitsOnce sync.Once
+)
+
+// Limits returns the content limits, reading them from the environment on first use
+func Limits() ContentLimits {
+	contentLimitsOnce.Do(func() {
+		contentLimits = ContentLimits{
+			MaxMessageLength:  envInt("MAX_MESSAGE_LENGTH", DefaultMaxMessageLength, 1),
+			MaxAttachments:    envInt("MAX_ATTACHMENTS_PER_MESSAGE", DefaultMaxAttachments, 0),
+			AttachmentSchemes: []string{"https", "http"},
+			MaxPayloadBytes:   int64(envInt("MAX_MESSAGE_PAYLOAD_BYTES", DefaultMaxPayloadBytes, 1024)),
+		}
+		if raw := os.Getenv("ATTACHMENT_URL_SCHEMES"); raw != "" {
+			var schemes []string
+			for _, scheme := range strings.Split(raw, ",") {
+				if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+					schemes = append(schemes, scheme)
+				}
+			}
+			if len(schemes) > 0 {
+				contentLimits.AttachmentSchemes = schemes
+			} else {
+				log.Printf("Ignoring ATTACHMENT_URL_SCHEMES=%q, using https and http", raw)
+			}
+		}
+	})
+	return contentLimits
+}
+
+// envInt reads a whole number of at least min from the environment, falling
+// back to def when it is unset or invalid
+func envInt(name string, def, min int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < min {
+		log.Printf("Ignoring %s=%q, using %d", name, raw, def)
+		return def
+	}
+	return n
+}
+
+// ValidateContent checks message text and its attachment against the content
+// limits. It returns a *ContentError for content that must be rejected.
+func ValidateContent(content, attachmentURL, attachmentType string) error {
+	limits := Limits()
+
+	if !utf8.ValidString(content) {
+		return &ContentError{Code: ContentInvalidUTF8, Message: "Message text is not valid UTF-8"}
+	}
+	if utf8.RuneCountInString(content) > limits.MaxMessageLength {
+		return &ContentError{
+			Code:    ContentTooLong,
+			Message: fmt.Sprintf("Messages can be at most %d characters long", limits.MaxMessageLength),
+			Limit:   limits.MaxMessageLength,
+		}
+	}
+
+	if attachmentURL == "" {
+		if attachmentType != "" {
+			return &ContentError{Code: ContentInvalidAttachmentType, Message: "attachment_type needs an attachment_url"}
+		}
+		return nil
+	}
+	if limits.MaxAttachments < 1 {
+		return &ContentError{Code: ContentTooManyAttachments, Message: "Attachments are not allowed", Limit: limits.MaxAttachments}
+	}
+	if err := validateAttachmentURL(attachmentURL, limits.AttachmentSchemes); err != nil {
+		return err
+	}
+	return validateAttachmentType(attachmentType)
+}
+
+// validateAttachmentURL accepts absolute URLs with one of the allowed schemes.
+// Clients open these directly, so anything else, like javascript:, is refused.
+func validateAttachmentURL(rawURL string, schemes []string) error {
+	invalid := &ContentError{
+		Code:    ContentInvalidAttachmentURL,
+		Message: "attachment_url must be an absolute URL using " + strings.Join(schemes, ", "),
+	}
+	if len(rawURL) > maxAttachmentURLLength {
+		invalid.Message = fmt.Sprintf("attachment_url can be at most %d bytes long", maxAttachmentURLLength)
+		invalid.Limit = maxAttachmentURLLength
+		return invalid
+	}
+	if !utf8.ValidString(rawURL) || strings.ContainsAny(rawURL, " \t\r\n") {
+		return invalid
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.User != nil {
+		return invalid
+	}
+	for _, scheme := range schemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return nil
+		}
+	}
+	return invalid
+}
+
+// validateAttachmentType accepts an empty type, a kind like "image" or a
+// media type like "image/png" whose top level is a known kind
+func validateAttachmentType(attachmentType string) error {
+	if attachmentType == "" {
+		return nil
+	}
+	invalid := &ContentError{
+		Code:    ContentInvalidAttachmentType,
+		Message: "attachment_type must be image, video, audio, text, application or file, or a media type like image/png",
+	}
+	if len(attachmentType) > maxAttachmentTypeLength {
+		return invalid
+	}
+	kind := strings.ToLower(attachmentType)
+	if strings.Contains(kind, "/") {
+		mediaType, _, err := mime.ParseMediaType(kind)
+		if err != nil {
+			return invalid
+		}
+		kind, _, _ = strings.Cut(mediaType, "/")
+	}
+	if !attachmentKinds[kind] {
+		return invalid
+	}
+	return nil
+}
+
+// parseContent converts message content into rich text. Emoji nodes are kept
+// only for shortcodes that are custom emoji; the rest go back to plain text.
+func parseContent(ctx context.Context, content string) (*models.RichText, error) {
+	if content == "" {
+		return nil, nil
+	}
+	rich := markdown.Parse(content)
+
+	var shortcodes []string
+	walkInlines(rich.Blocks, func(nodes []models.RichInline) []models.RichInline {
+		for _, node := range nodes {
+			if node.Type == models.InlineEmoji {
+				shortcodes = append(shortcodes, node.Text)
+			}
+		}
+		return nodes
+	})
+	if len(shortcodes) == 0 {
+		return rich, nil
+	}
+
+	cur, err := mongodb.ChatDB.Collection("custom_emoji").Find(ctx,
+		bson.M{"shortcode": bson.M{"$in": shortcodes}},
+		options.Find().SetProjection(bson.M{"shortcode": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var found []models.CustomEmoji
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(found))
+	for _, emoji := range found {
+		known[emoji.Shortcode] = true
+	}
+	resolveEmoji(rich, known)
+	return rich, nil
+}
+
+// walkInlines replaces every run of inline nodes in the blocks, nested ones
+// included, with what fn returns for it. Children are visited before their parent.
+func walkInlines(blocks []models.RichBlock, fn func([]models.RichInline) []models.RichInline) {
+	for i := range blocks {
+		blocks[i].Inlines = walkInlineRun(blocks[i].Inlines, fn)
+		for j := range blocks[i].Items {
+			blocks[i].Items[j] = walkInlineRun(blocks[i].Items[j], fn)
+		}
+		walkInlines(blocks[i].Blocks, fn)
+	}
+}
+
+func walkInlineRun(nodes []models.RichInline, fn func([]models.RichInline) []models.RichInline) []models.RichInline {
+	for i := range nodes {
+		if len(nodes[i].Children) > 0 {
+			nodes[i].Children = walkInlineRun(nodes[i].Children, fn)
+		}
+	}
+	return fn(nodes)
+}
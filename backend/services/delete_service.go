@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Deletion scopes
+const (
+	DeleteForEveryone = "everyone" // replace the message with a tombstone for the whole room
+	DeleteForMe       = "me"       // hide the message from the caller only
+)
+
+// MaxDeleteReasonLength caps the reason a moderator gives for removing a message
+const MaxDeleteReasonLength = 500
+
+var (
+	// ErrDeleteNotAllowed is returned when someone other than the sender or a moderator deletes a message for everyone
+	ErrDeleteNotAllowed = errors.New("only the sender or a moderator can delete this message for everyone")
+	// ErrDeleteWindowExpired is returned when the room's delete window has passed
+	ErrDeleteWindowExpired = errors.New("message can no longer be deleted for everyone")
+)
+
+// redactedFields are removed from a message deleted for everyone. The
+// content, attachment and everything derived from them go; the message's
+// place in the room and its thread stay.
+var redactedFields = bson.M{
+	"rich":              "",
+	"attachment_url":    "",
+	"attachment_type":   "",
+	"forwarded_from_id": "",
+	"previews":          "",
+	"poll":              "",
+	"message_type":      "",
+	"mentions":          "",
+	"user_reactions":    "",
+	"pinned":            "",
+	"pinned_by":         "",
+	"pinned_at":         "",
+	"edited_at":         "",
+	"edit_count":        "",
+}
+
+// IsModerator reports whether the user may delete other people's messages
+// in a room: room admins and server admins. Direct messages have no moderators
+// besides server admins.
+func IsModerator(ctx context.Context, roomID string, userID int) (bool, error) {
+	if IsServerAdmin(userID) {
+		return true, nil
+	}
+	if _, ok := PrivateRoomParticipants(roomID); ok {
+		return false, nil
+	}
+	return IsRoomAdmin(ctx, roomID, userID)
+}
+
+// DeleteMessageForEveryone replaces a message with a tombstone: its content,
+// attachment, reactions and edit history are removed from the database.
+// Senders may delete their own messages within the room's delete window;
+// moderators may delete any message at any time, and their reason is kept
+// on the tombstone.
+func DeleteMessageForEveryone(ctx context.Context, messageID primitive.ObjectID, actorID int, reason string) (*models.Message, error) {
+	msg, err := GetMessageByID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Deleted {
+		return nil, ErrMessageDeleted
+	}
+
+	isModerator, err := IsModerator(ctx, msg.RoomID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if msg.SenderID != actorID {
+		if !isModerator {
+			return nil, ErrDeleteNotAllowed
+		}
+	} else {
+		// Reasons are only recorded for moderation
+		reason = ""
+		if !isModerator {
+			room, err := GetRoom(ctx, msg.RoomID)
+			if err != nil && err != mongo.ErrNoDocuments {
+				return nil, err
+			}
+			if room != nil && room.Policy.DeleteWindowSeconds > 0 &&
+				now-msg.Timestamp > int64(room.Policy.DeleteWindowSeconds) {
+				return nil, ErrDeleteWindowExpired
+			}
+		}
+	}
+
+	// Unpinning first hands the room's pin slot back exactly once
+	if err := UnpinMessage(ctx, messageID); err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	set := bson.M{"deleted": true, "deleted_at": now, "deleted_by": actorID, "message": ""}
+	if reason != "" {
+		set["delete_reason"] = reason
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var tombstone models.Message
+	err = mongodb.ChatDB.Collection("messages").FindOneAndUpdate(ctx,
+		bson.M{"_id": messageID, "deleted": false},
+		bson.M{"$set": set, "$unset": redactedFields},
+		opts,
+	).Decode(&tombstone)
+	if err == mongo.ErrNoDocuments {
+		// Deleted by someone else in the meantime
+		return nil, ErrMessageDeleted
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Earlier versions and mention records still hold the text; stars would
+	// only point at the tombstone
+	for _, name := range []string{"message_edits", "mentions", "stars"} {
+		if _, err := mongodb.ChatDB.Collection(name).DeleteMany(ctx, bson.M{"message_id": messageID}); err != nil {
+			return nil, err
+		}
+	}
+	if err := resetRoomPreview(ctx, tombstone.RoomID, []primitive.ObjectID{messageID}); err != nil {
+		return nil, err
+	}
+	if err := discountUnread(ctx, msg, nil); err != nil {
+		return nil, err
+	}
+	return &tombstone, nil
+}
+
+// DeleteMessageForMe hides a message from one user's history, threads and
+// search results. Everyone else still sees it.
+func DeleteMessageForMe(ctx context.Context, messageID primitive.ObjectID, userID int) error {
+	messages := mongodb.ChatDB.Collection("messages")
+	var before models.Message
+	err := messages.FindOneAndUpdate(ctx,
+		bson.M{"_id": messageID, "hidden_for": bson.M{"$ne": userID}},
+		bson.M{"$addToSet": bson.M{"hidden_for": userID}},
+	).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		// Either hidden already or not there at all
+		return messages.FindOne(ctx, bson.M{"_id": messageID}, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	}
+	if err != nil {
+		return err
+	}
+	return discountUnread(ctx, &before, []int{userID})
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxDraftLength caps a draft's content, in characters
+const MaxDraftLength = 10000
+
+// ErrDraftTooLong is returned when a draft exceeds MaxDraftLength
+var ErrDraftTooLong = errors.New("draft must be at most 10000 characters")
+
+// SaveDraft stores the user's draft for a room, replacing any earlier one
+func SaveDraft(ctx context.Context, userID int, roomID, content string, replyToID *primitive.ObjectID) (*models.Draft, error) {
+	if utf8.RuneCountInString(content) > MaxDraftLength {
+		return nil, ErrDraftTooLong
+	}
+
+	set := bson.M{"content": content, "updated_at": time.Now().Unix()}
+	update := bson.M{"$set": set}
+	if replyToID != nil {
+		set["reply_to_id"] = *replyToID
+	} else {
+		update["$unset"] = bson.M{"reply_to_id": ""}
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var draft models.Draft
+	err := mongodb.ChatDB.Collection("drafts").FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID, "room_id": roomID},
+		update,
+		opts,
+	).Decode(&draft)
+	if err != nil {
+		return nil, err
+	}
+	return &draft, nil
+}
+
+// GetDraft returns the user's draft for a room
+func GetDraft(ctx context.Context, userID int, roomID string) (*models.Draft, error) {
+	var draft models.Draft
+	err := mongodb.ChatDB.Collection("drafts").FindOne(ctx, bson.M{"user_id": userID, "room_id": roomID}).Decode(&draft)
+	if err != nil {
+		return nil, err
+	}
+	return &draft, nil
+}
+
+// DeleteDraft removes the user's draft for a room. It returns false when there was none.
+func DeleteDraft(ctx context.Context, userID int, roomID string) (bool, error) {
+	result, err := mongodb.ChatDB.Collection("drafts").DeleteOne(ctx, bson.M{"user_id": userID, "room_id": roomID})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// ListDrafts returns all of the user's drafts, most recently changed first
+func ListDrafts(ctx context.Context, userID int) ([]models.Draft, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	cur, err := mongodb.ChatDB.Collection("drafts").Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	drafts := []models.Draft{}
+	if err := cur.All(ctx, &drafts); err != nil {
+		return nil, err
+	}
+	return drafts, nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrNotMessageSender is returned when someone other than the sender changes a message
+	ErrNotMessageSender = errors.New("only the sender can change this message")
+	// ErrMessageDeleted is returned when changing a deleted message
+	ErrMessageDeleted = errors.New("message has been deleted")
+	// ErrEditWindowExpired is returned when the room's edit window has passed
+	ErrEditWindowExpired = errors.New("message can no longer be edited")
+	// ErrEditConflict is returned when the message changed while it was being edited
+	ErrEditConflict = errors.New("message was changed by another edit")
+	// ErrEmptyMessage is returned when an edit would leave a message with no content
+	ErrEmptyMessage = errors.New("either message content or attachment is required")
+	// ErrMessageNotEditable is returned when editing a poll or a server-generated message
+	ErrMessageNotEditable = errors.New("polls and system messages cannot be edited")
+)
+
+// EditMessage replaces a message's content on behalf of its sender and keeps
+// the previous version in the edit history. Mentions are resolved again from
+// the new content; it returns the users the edit newly mentions.
+func EditMessage(ctx context.Context, messageID primitive.ObjectID, editorID int, content string) (*models.Message, []int, error) {
+	original, err := GetMessageByID(ctx, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if original.SenderID != editorID {
+		return nil, nil, ErrNotMessageSender
+	}
+	if original.Deleted {
+		return nil, nil, ErrMessageDeleted
+	}
+	if original.MessageType == models.MessageTypePoll || original.MessageType == models.MessageTypeSystem {
+		return nil, nil, ErrMessageNotEditable
+	}
+	if content == "" && original.AttachmentURL == "" {
+		return nil, nil, ErrEmptyMessage
+	}
+	if err := ValidateContent(content, "", ""); err != nil {
+		return nil, nil, err
+	}
+	if content == original.Message {
+		return original, nil, nil
+	}
+
+	now := time.Now().Unix()
+	room, err := GetRoom(ctx, original.RoomID)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, nil, err
+	}
+	if room != nil && room.Policy.EditWindowSeconds > 0 &&
+		now-original.Timestamp > int64(room.Policy.EditWindowSeconds) {
+		return nil, nil, ErrEditWindowExpired
+	}
+
+	rich, err := parseContent(ctx, content)
+	if err != nil {
+		return nil, nil, err
+	}
+	edited := *original
+	edited.Message = content
+	edited.Rich = rich
+	// Forwarded copies keep their text but should not ping the new room
+	if original.ForwardedFromID == nil {
+		if edited.Mentions, err = resolveMentions(ctx, &edited); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Keep the previous version before replacing it, so the history never
+	// misses a version the message had
+	edit := models.MessageEdit{
+		MessageID:       messageID,
+		RoomID:          original.RoomID,
+		EditorID:        editorID,
+		Version:         original.EditCount,
+		PreviousContent: original.Message,
+		EditedAt:        now,
+	}
+	inserted, err := mongodb.ChatDB.Collection("message_edits").InsertOne(ctx, edit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only apply the edit if nobody else edited the message since it was read
+	filter := bson.M{"_id": messageID, "deleted": false}
+	if original.EditCount == 0 {
+		filter["edit_count"] = bson.M{"$exists": false}
+	} else {
+		filter["edit_count"] = original.EditCount
+	}
+	set := bson.M{"message": content, "rich": rich, "edited_at": now}
+	unset := bson.M{"previews": ""} // rebuilt from the new content
+	if len(edited.Mentions) > 0 {
+		set["mentions"] = edited.Mentions
+	} else {
+		unset["mentions"] = ""
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated models.Message
+	err = mongodb.ChatDB.Collection("messages").FindOneAndUpdate(ctx,
+		filter,
+		bson.M{"$set": set, "$inc": bson.M{"edit_count": 1}, "$unset": unset},
+		opts,
+	).Decode(&updated)
+	if err != nil {
+		// The edit was not applied, so neither is its history entry
+		if _, delErr := mongodb.ChatDB.Collection("message_edits").DeleteOne(ctx, bson.M{"_id": inserted.InsertedID}); delErr != nil {
+			log.Println("Failed to remove edit history of a failed edit:", delErr)
+		}
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, ErrEditConflict
+		}
+		return nil, nil, err
+	}
+
+	added, err := updateMentions(ctx, original.Mentions, &updated)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := refreshRoomPreview(ctx, &updated); err != nil {
+		return nil, nil, err
+	}
+	return &updated, added, nil
+}
+
+// GetMessageEdits returns the previous versions of a message, oldest first
+func GetMessageEdits(ctx context.Context, messageID primitive.ObjectID) ([]models.MessageEdit, error) {
+	opts := options.Find().SetSort(bson.D{primitive.E{Key: "version", Value: 1}})
+	cur, err := mongodb.ChatDB.Collection("message_edits").Find(ctx, bson.M{"message_id": messageID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	edits := []models.MessageEdit{}
+	if err := cur.All(ctx, &edits); err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxEmojiImageBytes caps the size of an uploaded custom emoji image
+const MaxEmojiImageBytes = 256 * 1024
+
+// emojiVersionID is the document in the meta collection holding the custom emoji version
+const emojiVersionID = "custom_emoji"
+
+// EmojiImageTypes are the image formats accepted for custom emoji
+var EmojiImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/gif":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+}
+
+var shortcodePattern = regexp.MustCompile(`^[a-z0-9_+-]{2,32}$`)
+
+var (
+	// ErrInvalidShortcode is returned for shortcodes outside [a-z0-9_+-]{2,32}
+	ErrInvalidShortcode = errors.New("shortcode must be 2 to 32 lowercase letters, digits, _, + or -")
+	// ErrShortcodeTaken is returned when a custom emoji with the shortcode already exists
+	ErrShortcodeTaken = errors.New("a custom emoji with this shortcode already exists")
+	// ErrInvalidEmojiImage is returned for images that are too large or not a supported format
+	ErrInvalidEmojiImage = errors.New("emoji image must be a PNG, GIF, JPEG or WebP of at most 256 KB")
+)
+
+// IsServerAdmin reports whether the user is listed in ADMIN_USER_IDS
+func IsServerAdmin(userID int) bool {
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(id)); err == nil && n == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeShortcode strips surrounding colons and checks the shortcode's format
+func NormalizeShortcode(shortcode string) (string, error) {
+	shortcode = strings.Trim(strings.TrimSpace(shortcode), ":")
+	if !shortcodePattern.MatchString(shortcode) {
+		return "", ErrInvalidShortcode
+	}
+	return shortcode, nil
+}
+
+// CreateCustomEmoji stores an uploaded emoji image and bumps the emoji version
+func CreateCustomEmoji(ctx context.Context, emoji *models.CustomEmoji) error {
+	shortcode, err := NormalizeShortcode(emoji.Shortcode)
+	if err != nil {
+		return err
+	}
+	if len(emoji.Data) == 0 || len(emoji.Data) > MaxEmojiImageBytes || !EmojiImageTypes[emoji.ContentType] {
+		return ErrInvalidEmojiImage
+	}
+
+	emoji.Shortcode = shortcode
+	emoji.Size = len(emoji.Data)
+	emoji.CreatedAt = time.Now().Unix()
+	if _, err := mongodb.ChatDB.Collection("custom_emoji").InsertOne(ctx, emoji); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrShortcodeTaken
+		}
+		return err
+	}
+
+	version, err := bumpEmojiVersion(ctx)
+	if err != nil {
+		return err
+	}
+	emoji.Version = version
+	return nil
+}
+
+// DeleteCustomEmoji removes a custom emoji. Reactions that used it are left
+// as they are and keep showing the shortcode.
+func DeleteCustomEmoji(ctx context.Context, shortcode string) error {
+	result, err := mongodb.ChatDB.Collection("custom_emoji").DeleteOne(ctx, bson.M{"shortcode": shortcode})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	_, err = bumpEmojiVersion(ctx)
+	return err
+}
+
+// ListCustomEmoji returns every custom emoji, without image data, and the current version
+func ListCustomEmoji(ctx context.Context) ([]models.CustomEmoji, int64, error) {
+	version, err := GetEmojiVersion(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"data": 0}).
+		SetSort(bson.D{{Key: "shortcode", Value: 1}})
+	cur, err := mongodb.ChatDB.Collection("custom_emoji").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	emoji := []models.CustomEmoji{}
+	if err := cur.All(ctx, &emoji); err != nil {
+		return nil, 0, err
+	}
+	return emoji, version, nil
+}
+
+// GetCustomEmoji loads a custom emoji, including its image, by shortcode
+func GetCustomEmoji(ctx context.Context, shortcode string) (*models.CustomEmoji, error) {
+	var emoji models.CustomEmoji
+	err := mongodb.ChatDB.Collection("custom_emoji").FindOne(ctx, bson.M{"shortcode": shortcode}).Decode(&emoji)
+	if err != nil {
+		return nil, err
+	}
+	return &emoji, nil
+}
+
+// EmojiImageURL is where a custom emoji's image is served from
+func EmojiImageURL(shortcode string) string {
+	return "/emoji/" + shortcode + "/image"
+}
+
+// resolveEmoji points emoji nodes for known shortcodes at their image and
+// turns the others back into the text they were parsed from
+func resolveEmoji(rich *models.RichText, known map[string]bool) {
+	walkInlines(rich.Blocks, func(nodes []models.RichInline) []models.RichInline {
+		resolved := nodes[:0]
+		for _, node := range nodes {
+			if node.Type == models.InlineEmoji {
+				if known[node.Text] {
+					node.URL = EmojiImageURL(node.Text)
+				} else {
+					node = models.RichInline{Type: models.InlineText, Text: ":" + node.Text + ":"}
+				}
+			}
+			// Keep runs of plain text in one node
+			if last := len(resolved) - 1; node.Type == models.InlineText && last >= 0 && resolved[last].Type == models.InlineText {
+				resolved[last].Text += node.Text
+				continue
+			}
+			resolved = append(resolved, node)
+		}
+		return resolved
+	})
+}
+
+// customEmojiExists reports whether a custom emoji with the shortcode exists
+func customEmojiExists(ctx context.Context, shortcode string) (bool, error) {
+	count, err := mongodb.ChatDB.Collection("custom_emoji").CountDocuments(ctx,
+		bson.M{"shortcode": shortcode}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// GetEmojiVersion returns the custom emoji version, which changes whenever
+// an emoji is added or deleted
+func GetEmojiVersion(ctx context.Context) (int64, error) {
+	var meta struct {
+		Version int64 `bson:"version"`
+	}
+	err := mongodb.ChatDB.Collection("meta").FindOne(ctx, bson.M{"_id": emojiVersionID}).Decode(&meta)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return meta.Version, err
+}
+
+// bumpEmojiVersion increments and returns the custom emoji version
+func bumpEmojiVersion(ctx context.Context) (int64, error) {
+	var meta struct {
+		Version int64 `bson:"version"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := mongodb.ChatDB.Collection("meta").FindOneAndUpdate(ctx,
+		bson.M{"_id": emojiVersionID},
+		bson.M{"$inc": bson.M{"version": 1}},
+		opts,
+	).Decode(&meta)
+	return meta.Version, err
+}
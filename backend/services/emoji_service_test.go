@@ -0,0 +1,31 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"go-react-chat/kalpesh-vala/github.com/internal/markdown"
+	"go-react-chat/kalpesh-vala/github.com/models"
+)
+
+func TestResolveEmoji(t *testing.T) {
+	rich := markdown.Parse("hi :party: and :nope: **:party:**\n- :nope:")
+	resolveEmoji(rich, map[string]bool{"party": true})
+
+	party := models.RichInline{Type: models.InlineEmoji, Text: "party", URL: "/emoji/party/image"}
+	want := []models.RichBlock{
+		{Type: models.BlockParagraph, Inlines: []models.RichInline{
+			{Type: models.InlineText, Text: "hi "},
+			party,
+			// Unknown shortcodes become text again, merged with the text around them
+			{Type: models.InlineText, Text: " and :nope: "},
+			{Type: models.InlineBold, Children: []models.RichInline{party}},
+		}},
+		{Type: models.BlockList, Items: [][]models.RichInline{
+			{{Type: models.InlineText, Text: ":nope:"}},
+		}},
+	}
+	if !reflect.DeepEqual(rich.Blocks, want) {
+		t.Errorf("blocks = %+v, want %+v", rich.Blocks, want)
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// expiryBatchSize caps how many expired messages are removed in one pass
+const expiryBatchSize = 500
+
+// messageExpiry returns when a message sent to the room at sentAt should
+// disappear, or nil when the room keeps its messages
+func messageExpiry(ctx context.Context, roomID string, sentAt time.Time) (*time.Time, error) {
+	room, err := GetRoom(ctx, roomID)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if room.Policy.MessageTTLSeconds <= 0 {
+		return nil, nil
+	}
+	expiresAt := sentAt.Add(time.Duration(room.Policy.MessageTTLSeconds) * time.Second)
+	return &expiresAt, nil
+}
+
+// DeleteExpiredMessages removes messages whose expiry has passed, along with
+// their edit history and mentions, and returns the removed IDs by room.
+// The TTL index on expires_at only removes messages this missed for a day.
+func DeleteExpiredMessages(ctx context.Context) (map[string][]primitive.ObjectID, error) {
+	messages := mongodb.ChatDB.Collection("messages")
+	now := time.Now()
+
+	opts := options.Find().
+		SetProjection(bson.M{
+			"_id": 1, "room_id": 1, "sender_id": 1, "timestamp": 1,
+			"message_type": 1, "deleted": 1, "hidden_for": 1,
+		}).
+		SetSort(bson.D{{Key: "expires_at", Value: 1}}).
+		SetLimit(expiryBatchSize)
+	cur, err := messages.Find(ctx, bson.M{"expires_at": bson.M{"$lte": now}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var expired []models.Message
+	if err := cur.All(ctx, &expired); err != nil {
+		return nil, err
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	byRoom := map[string][]primitive.ObjectID{}
+	ids := make([]primitive.ObjectID, 0, len(expired))
+	for _, msg := range expired {
+		byRoom[msg.RoomID] = append(byRoom[msg.RoomID], msg.ID)
+		ids = append(ids, msg.ID)
+	}
+
+	// Hand back the pin slots of expiring pinned messages before they go
+	for roomID, roomIDs := range byRoom {
+		unpinned, err := messages.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": roomIDs}, "pinned": true, "deleted": false},
+			bson.M{"$unset": bson.M{"pinned": "", "pinned_by": "", "pinned_at": ""}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if unpinned.ModifiedCount > 0 {
+			if err := releasePins(ctx, roomID, int(unpinned.ModifiedCount)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if _, err := messages.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"message_edits", "mentions", "stars"} {
+		if _, err := mongodb.ChatDB.Collection(name).DeleteMany(ctx, bson.M{"message_id": bson.M{"$in": ids}}); err != nil {
+			return nil, err
+		}
+	}
+	for roomID, roomIDs := range byRoom {
+		if err := resetRoomPreview(ctx, roomID, roomIDs); err != nil {
+			return nil, err
+		}
+	}
+	for i := range expired {
+		if err := discountUnread(ctx, &expired[i], nil); err != nil {
+			return nil, err
+		}
+	}
+	return byRoom, nil
+}
+
+// resetRoomPreview points a room's preview at its newest remaining message
+// when the previewed message was one of the removed ones
+func resetRoomPreview(ctx context.Context, roomID string, removed []primitive.ObjectID) error {
+	filter := bson.M{"_id": roomID, "last_message.message_id": bson.M{"$in": removed}}
+
+	var latest models.Message
+	err := mongodb.ChatDB.Collection("messages").FindOne(ctx,
+		bson.M{"room_id": roomID, "deleted": false},
+		options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}),
+	).Decode(&latest)
+	if err == mongo.ErrNoDocuments {
+		_, err = mongodb.ChatDB.Collection("rooms").UpdateOne(ctx, filter, bson.M{"$unset": bson.M{"last_message": ""}})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	_, err = mongodb.ChatDB.Collection("rooms").UpdateOne(ctx, filter, bson.M{"$set": bson.M{"last_message": buildPreview(&latest)}})
+	return err
+}
+
+// PostSystemMessage stores a server-generated message in a room on behalf of actorID
+func PostSystemMessage(ctx context.Context, roomID string, actorID int, text string) (*models.Message, error) {
+	_, isDirect := PrivateRoomParticipants(roomID)
+	msg := models.Message{
+		RoomID:      roomID,
+		SenderID:    actorID,
+		Message:     text,
+		IsGroup:     !isDirect,
+		Status:      models.MessageStatusSent,
+		MessageType: models.MessageTypeSystem,
+		Deleted:     false,
+	}
+	if err := InsertMessage(ctx, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// DescribeMessageTTL renders a disappearing message setting for system messages
+func DescribeMessageTTL(seconds int) string {
+	if seconds <= 0 {
+		return "Disappearing messages were turned off"
+	}
+	return "Messages now disappear " + formatDuration(seconds) + " after they are sent"
+}
+
+// formatDuration writes seconds in the largest whole unit, e.g. "1 day" or "90 minutes"
+func formatDuration(seconds int) string {
+	units := []struct {
+		name    string
+		seconds int
+	}{
+		{"week", 7 * 24 * 3600},
+		{"day", 24 * 3600},
+		{"hour", 3600},
+		{"minute", 60},
+		{"second", 1},
+	}
+	for _, unit := range units {
+		if seconds%unit.seconds == 0 {
+			n := seconds / unit.seconds
+			if n == 1 {
+				return "1 " + unit.name
+			}
+			return fmt.Sprintf("%d %ss", n, unit.name)
+		}
+	}
+	return fmt.Sprintf("%d seconds", seconds)
+}
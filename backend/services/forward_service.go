@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-react-chat/kalpesh-vala/github.com/models"
+)
+
+// MaxForwardTargets is the number of rooms a message can be forwarded to at once
+const MaxForwardTargets = 10
+
+// ErrMessageNotForwardable is returned when forwarding a poll or a server-generated message
+var ErrMessageNotForwardable = errors.New("polls and system messages cannot be forwarded")
+
+// CheckForwardable reports why a message cannot be forwarded, if it cannot
+func CheckForwardable(msg *models.Message) error {
+	if msg.Deleted {
+		return ErrMessageDeleted
+	}
+	if msg.MessageType == models.MessageTypePoll || msg.MessageType == models.MessageTypeSystem {
+		return ErrMessageNotForwardable
+	}
+	return nil
+}
+
+// ForwardMessage copies a message, including its attachment, into another room
+// as a new message from senderID that records where it was forwarded from
+func ForwardMessage(ctx context.Context, source *models.Message, senderID int, roomID string) (*models.Message, error) {
+	if err := CheckForwardable(source); err != nil {
+		return nil, err
+	}
+
+	isGroup, err := roomIsGroup(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceID := source.ID.Hex()
+	msg := models.Message{
+		RoomID:          roomID,
+		SenderID:        senderID,
+		Message:         source.Message,
+		IsGroup:         isGroup,
+		Status:          models.MessageStatusSent,
+		AttachmentURL:   source.AttachmentURL,
+		AttachmentType:  source.AttachmentType,
+		ForwardedFromID: &sourceID,
+		Deleted:         false,
+	}
+	if err := InsertMessage(ctx, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
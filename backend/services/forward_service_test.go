@@ -0,0 +1,25 @@
+package services
+
+import (
+	"testing"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+)
+
+func TestCheckForwardable(t *testing.T) {
+	tests := []struct {
+		msg  models.Message
+		want error
+	}{
+		{models.Message{Message: "hi"}, nil},
+		{models.Message{AttachmentURL: "https://cdn.example.com/a.png"}, nil},
+		{models.Message{Message: "hi", Deleted: true}, ErrMessageDeleted},
+		{models.Message{MessageType: models.MessageTypePoll}, ErrMessageNotForwardable},
+		{models.Message{Message: "Changed the topic", MessageType: models.MessageTypeSystem}, ErrMessageNotForwardable},
+	}
+	for _, tt := range tests {
+		if got := CheckForwardable(&tt.msg); got != tt.want {
+			t.Errorf("CheckForwardable(%+v) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/db/postgres"
+	"go-react-chat/kalpesh-vala/github.com/db/redis"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Special mentions that notify several room members at once
+const (
+	mentionHere    = "here"    // members who are currently online
+	mentionChannel = "channel" // every member
+)
+
+// parseMentions returns the usernames mentioned in rich text, lowercased and
+// without duplicates, and whether @here or @channel was used. Mentions inside
+// code are text, so they never count.
+func parseMentions(rich *models.RichText) ([]string, bool, bool) {
+	if rich == nil {
+		return nil, false, false
+	}
+	var usernames []string
+	seen := map[string]bool{}
+	here, channel := false, false
+
+	walkInlines(rich.Blocks, func(nodes []models.RichInline) []models.RichInline {
+		for _, node := range nodes {
+			if node.Type != models.InlineMention {
+				continue
+			}
+			switch name := strings.ToLower(node.Text); {
+			case name == mentionHere:
+				here = true
+			case name == mentionChannel:
+				channel = true
+			case !seen[name]:
+				seen[name] = true
+				usernames = append(usernames, name)
+			}
+		}
+		return nodes
+	})
+	return usernames, here, channel
+}
+
+// roomMemberIDs lists the user IDs that belong to a room
+func roomMemberIDs(ctx context.Context, roomID string) ([]int, error) {
+	if participants, ok := PrivateRoomParticipants(roomID); ok {
+		return participants, nil
+	}
+
+	opts := options.Find().SetProjection(bson.M{"user_id": 1})
+	cur, err := mongodb.ChatDB.Collection("room_members").Find(ctx, bson.M{"room_id": roomID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var members []models.RoomMember
+	if err := cur.All(ctx, &members); err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]int, 0, len(members))
+	for _, m := range members {
+		userIDs = append(userIDs, m.UserID)
+	}
+	return userIDs, nil
+}
+
+// resolveMentions turns the mentions in a message's rich text into the IDs of
+// the room members they address. Mentions of users outside the room are ignored, and
+// the sender is never mentioned by their own message.
+func resolveMentions(ctx context.Context, msg *models.Message) ([]int, error) {
+	usernames, here, channel := parseMentions(msg.Rich)
+	if len(usernames) == 0 && !here && !channel {
+		return nil, nil
+	}
+
+	memberIDs, err := roomMemberIDs(ctx, msg.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	isMember := make(map[int]bool, len(memberIDs))
+	for _, id := range memberIDs {
+		isMember[id] = true
+	}
+
+	mentioned := map[int]bool{}
+	if len(usernames) > 0 {
+		ids, err := postgres.GetUserIDsByUsernames(postgres.DB, usernames)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if isMember[id] {
+				mentioned[id] = true
+			}
+		}
+	}
+	if channel {
+		for _, id := range memberIDs {
+			mentioned[id] = true
+		}
+	} else if here {
+		keys := make([]string, len(memberIDs))
+		for i, id := range memberIDs {
+			keys[i] = strconv.Itoa(id)
+		}
+		// Without presence, @here reaches no one rather than failing the send
+		if online, err := redis.OnlineUsers(keys); err == nil {
+			for _, id := range memberIDs {
+				if online[strconv.Itoa(id)] {
+					mentioned[id] = true
+				}
+			}
+		}
+	}
+	delete(mentioned, msg.SenderID)
+
+	userIDs := make([]int, 0, len(mentioned))
+	for id := range mentioned {
+		userIDs = append(userIDs, id)
+	}
+	sort.Ints(userIDs)
+	return userIDs, nil
+}
+
+// recordMentions adds a stored message to the inbox of every mentioned user
+func recordMentions(ctx context.Context, msg *models.Message) error {
+	if len(msg.Mentions) == 0 {
+		return nil
+	}
+
+	preview := PreviewText(msg.Message)
+	docs := make([]interface{}, 0, len(msg.Mentions))
+	for _, userID := range msg.Mentions {
+		docs = append(docs, models.Mention{
+			UserID:    userID,
+			RoomID:    msg.RoomID,
+			MessageID: msg.ID,
+			SenderID:  msg.SenderID,
+			Preview:   preview,
+			Timestamp: msg.Timestamp,
+		})
+	}
+	_, err := mongodb.ChatDB.Collection("mentions").InsertMany(ctx, docs)
+	return err
+}
+
+// updateMentions brings the mentions inbox in line with an edited message:
+// users no longer mentioned lose the entry, the others see the new text, and
+// newly mentioned users get one. It returns the newly mentioned users.
+func updateMentions(ctx context.Context, previous []int, msg *models.Message) ([]int, error) {
+	collection := mongodb.ChatDB.Collection("mentions")
+	wasMentioned := make(map[int]bool, len(previous))
+	for _, id := range previous {
+		wasMentioned[id] = true
+	}
+	kept, added := []int{}, []int{}
+	for _, id := range msg.Mentions {
+		if wasMentioned[id] {
+			kept = append(kept, id)
+		} else {
+			added = append(added, id)
+		}
+	}
+
+	if _, err := collection.DeleteMany(ctx, bson.M{
+		"message_id": msg.ID,
+		"user_id":    bson.M{"$nin": kept},
+	}); err != nil {
+		return nil, err
+	}
+	if len(kept) > 0 {
+		if _, err := collection.UpdateMany(ctx,
+			bson.M{"message_id": msg.ID},
+			bson.M{"$set": bson.M{"preview": PreviewText(msg.Message)}},
+		); err != nil {
+			return nil, err
+		}
+	}
+	newlyMentioned := *msg
+	newlyMentioned.Mentions = added
+	if err := recordMentions(ctx, &newlyMentioned); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// markMentionsRead clears a user's mentions in a room up to and including a message
+func markMentionsRead(ctx context.Context, roomID string, userID int, upTo primitive.ObjectID) error {
+	_, err := mongodb.ChatDB.Collection("mentions").UpdateMany(ctx, bson.M{
+		"room_id":    roomID,
+		"user_id":    userID,
+		"read":       false,
+		"message_id": bson.M{"$lte": upTo},
+	}, bson.M{"$set": bson.M{"read": true}})
+	return err
+}
+
+// GetUnreadMentions returns one page of the user's unread mentions, newest first
+func GetUnreadMentions(ctx context.Context, userID int, page, limit int) ([]models.Mention, int64, error) {
+	collection := mongodb.ChatDB.Collection("mentions")
+	filter := bson.M{"user_id": userID, "read": false}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cur, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	mentions := []models.Mention{}
+	if err := cur.All(ctx, &mentions); err != nil {
+		return nil, 0, err
+	}
+	return mentions, total, nil
+}
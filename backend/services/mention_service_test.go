@@ -0,0 +1,34 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"go-react-chat/kalpesh-vala/github.com/internal/markdown"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		content   string
+		usernames []string
+		here      bool
+		channel   bool
+	}{
+		{"hi @Alice and @bob, @alice again", []string{"alice", "bob"}, false, false},
+		{"**@carol** in a [link to @dave](https://example.com)", []string{"carol", "dave"}, false, false},
+		{"mail me@example.com", nil, false, false},
+		{"`@alice` stays code", nil, false, false},
+		{"```\n@alice in a block\n```", nil, false, false},
+		{"> @here\n- @channel", nil, true, true},
+	}
+	for _, tt := range tests {
+		usernames, here, channel := parseMentions(markdown.Parse(tt.content))
+		if !reflect.DeepEqual(usernames, tt.usernames) || here != tt.here || channel != tt.channel {
+			t.Errorf("parseMentions(%q) = %v, %v, %v, want %v, %v, %v",
+				tt.content, usernames, here, channel, tt.usernames, tt.here, tt.channel)
+		}
+	}
+	if usernames, here, channel := parseMentions(nil); usernames != nil || here || channel {
+		t.Errorf("parseMentions(nil) = %v, %v, %v, want nothing", usernames, here, channel)
+	}
+}
@@ -2,49 +2,342 @@ package services
 
 import (
 	"context"
+	"errors"
 	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
 	"go-react-chat/kalpesh-vala/github.com/models"
+	"log"
+	"regexp"
+	"strconv"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	// ErrInvalidClientMsgID is returned for a client_msg_id that is too long or has unexpected characters
+	ErrInvalidClientMsgID = errors.New("client_msg_id must be 1 to 64 letters, digits, '.', '_', ':' or '-'")
+	// ErrClientMsgIDInUse is returned when the sender already used the client_msg_id in another room
+	ErrClientMsgIDInUse = errors.New("client_msg_id was already used for a message in another room")
+	// ErrDuplicateMessage is returned by InsertMessage when the sender already
+	// stored a message with the same client_msg_id. The message is replaced by the stored one.
+	ErrDuplicateMessage = errors.New("message was already sent")
+)
+
+var clientMsgIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// ValidateClientMsgID checks the format of a client message ID. An empty ID is allowed.
+func ValidateClientMsgID(clientMsgID string) error {
+	if clientMsgID != "" && !clientMsgIDPattern.MatchString(clientMsgID) {
+		return ErrInvalidClientMsgID
+	}
+	return nil
+}
+
+// FindClientMessage returns the message the sender stored under a client
+// message ID. It returns mongo.ErrNoDocuments when there is none, and
+// ErrClientMsgIDInUse when the ID was used in a different room.
+func FindClientMessage(ctx context.Context, senderID int, roomID, clientMsgID string) (*models.Message, error) {
+	var stored models.Message
+	err := mongodb.ChatDB.Collection("messages").FindOne(ctx, bson.M{
+		"sender_id":     senderID,
+		"client_msg_id": clientMsgID,
+	}).Decode(&stored)
+	if err != nil {
+		return nil, err
+	}
+	if stored.RoomID != roomID {
+		return nil, ErrClientMsgIDInUse
+	}
+	return &stored, nil
+}
+
+// InsertMessage stores a new message. Content over the server's limits is
+// rejected with a *ContentError. When the sender already stored one with the
+// same client_msg_id, msg becomes that message and ErrDuplicateMessage is returned.
 func InsertMessage(ctx context.Context, msg *models.Message) error {
-	msg.ID = primitive.NewObjectID()
-	msg.Timestamp = time.Now().Unix()
+	if err := ValidateClientMsgID(msg.ClientMsgID); err != nil {
+		return err
+	}
+	if err := ValidateContent(msg.Message, msg.AttachmentURL, msg.AttachmentType); err != nil {
+		return err
+	}
+	if msg.ReplyToID != nil {
+		if err := validateReplyParent(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	rich, err := parseContent(ctx, msg.Message)
+	if err != nil {
+		return err
+	}
+	msg.Rich = rich
+
+	// Forwarded copies keep their text but should not ping the new room
+	if msg.ForwardedFromID == nil {
+		mentions, err := resolveMentions(ctx, msg)
+		if err != nil {
+			return err
+		}
+		msg.Mentions = mentions
+	}
+
+	// Scheduled messages arrive with the ID they were reserved under
+	if msg.ID.IsZero() {
+		msg.ID = primitive.NewObjectID()
+	}
+	now := time.Now()
+	msg.Timestamp = now.Unix()
+	expiresAt, err := messageExpiry(ctx, msg.RoomID, now)
+	if err != nil {
+		return err
+	}
+	msg.ExpiresAt = expiresAt
 	collection := mongodb.ChatDB.Collection("messages")
-	_, err := collection.InsertOne(ctx, msg)
-	return err
+	if _, err := collection.InsertOne(ctx, msg); err != nil {
+		// A resend that raced the original past the caller's lookup
+		if msg.ClientMsgID != "" && mongo.IsDuplicateKeyError(err) {
+			stored, findErr := FindClientMessage(ctx, msg.SenderID, msg.RoomID, msg.ClientMsgID)
+			if findErr != nil {
+				return findErr
+			}
+			*msg = *stored
+			return ErrDuplicateMessage
+		}
+		return err
+	}
+
+	if msg.ReplyToID != nil {
+		if err := recordThreadReply(ctx, msg); err != nil {
+			log.Println("Failed to update thread summary:", err)
+		}
+	}
+	if err := recordMentions(ctx, msg); err != nil {
+		log.Println("Failed to record mentions:", err)
+	}
+
+	// The message is stored; a stale conversation summary should not fail the send
+	if err := recordRoomActivity(ctx, msg); err != nil {
+		log.Println("Failed to update room activity:", err)
+	}
+	return nil
 }
 
-func GetMessagesByRoomID(ctx context.Context, roomID string) ([]models.Message, error) {
-	collection := mongodb.ChatDB.Collection("messages")
+// Message history page sizes
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 200
+)
+
+// ErrInvalidCursor is returned when a history cursor is neither a message ID in the room nor a timestamp
+var ErrInvalidCursor = errors.New("cursor must be a message ID in this room or a unix timestamp")
+
+// HistoryQuery selects one page of a room's history. At most one of Before,
+// After and Around may be set; each is a message ID or a unix timestamp.
+// With no cursor the latest messages are returned.
+type HistoryQuery struct {
+	Before string
+	After  string
+	Around string
+	Limit  int
+
+	// ViewerID leaves out messages this user deleted for themselves
+	ViewerID int
+}
 
-	// Filter: get all messages for room_id, including deleted ones
-	filter := bson.M{
-		"room_id": roomID,
+// historyCursor is a position in a room's (timestamp, _id) ordering.
+// A cursor built from a bare timestamp has no ID.
+type historyCursor struct {
+	timestamp int64
+	id        *primitive.ObjectID
+}
+
+// older matches messages before the cursor, or at it when inclusive
+func (cur historyCursor) older(inclusive bool) bson.M {
+	op := "$lt"
+	if inclusive {
+		op = "$lte"
+	}
+	if cur.id == nil {
+		return bson.M{"timestamp": bson.M{op: cur.timestamp}}
 	}
+	return bson.M{"$or": bson.A{
+		bson.M{"timestamp": bson.M{"$lt": cur.timestamp}},
+		bson.M{"timestamp": cur.timestamp, "_id": bson.M{op: *cur.id}},
+	}}
+}
 
-	// Sort by timestamp (oldest first)
-	opts := options.Find().SetSort(bson.D{primitive.E{Key: "timestamp", Value: 1}})
+// newer matches messages after the cursor, or at it when inclusive
+func (cur historyCursor) newer(inclusive bool) bson.M {
+	op := "$gt"
+	if inclusive {
+		op = "$gte"
+	}
+	if cur.id == nil {
+		return bson.M{"timestamp": bson.M{op: cur.timestamp}}
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"timestamp": bson.M{"$gt": cur.timestamp}},
+		bson.M{"timestamp": cur.timestamp, "_id": bson.M{op: *cur.id}},
+	}}
+}
+
+// resolveCursor turns a raw cursor into a position in the room's history
+func resolveCursor(ctx context.Context, roomID, raw string) (historyCursor, error) {
+	if id, err := primitive.ObjectIDFromHex(raw); err == nil {
+		msg, err := GetMessageByID(ctx, id)
+		if err == mongo.ErrNoDocuments || (err == nil && msg.RoomID != roomID) {
+			return historyCursor{}, ErrInvalidCursor
+		}
+		if err != nil {
+			return historyCursor{}, err
+		}
+		return historyCursor{timestamp: msg.Timestamp, id: &msg.ID}, nil
+	}
+
+	ts, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return historyCursor{}, ErrInvalidCursor
+	}
+	return historyCursor{timestamp: ts}, nil
+}
+
+// findHistory returns up to limit messages matching base and cond, walking
+// forward or backward in time, and whether more messages lie beyond them
+func findHistory(ctx context.Context, base, cond bson.M, forward bool, limit int) ([]models.Message, bool, error) {
+	collection := mongodb.ChatDB.Collection("messages")
+
+	dir := -1
+	if forward {
+		dir = 1
+	}
+	filter := bson.M{}
+	for k, v := range base {
+		filter[k] = v
+	}
+	if cond != nil {
+		filter["$and"] = bson.A{cond}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: dir}, {Key: "_id", Value: dir}}).
+		SetLimit(int64(limit + 1))
 
 	cur, err := collection.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	messages := []models.Message{}
+	if err := cur.All(ctx, &messages); err != nil {
+		return nil, false, err
 	}
-	defer cur.Close(ctx)
 
-	var messages []models.Message
-	for cur.Next(ctx) {
-		var msg models.Message
-		if err := cur.Decode(&msg); err != nil {
+	more := len(messages) > limit
+	if more {
+		messages = messages[:limit]
+	}
+	if !forward {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, more, nil
+}
+
+// historyExists reports whether any message matches base and cond
+func historyExists(ctx context.Context, base, cond bson.M) (bool, error) {
+	count, err := mongodb.ChatDB.Collection("messages").CountDocuments(ctx,
+		bson.M{"$and": bson.A{base, cond}},
+		options.Count().SetLimit(1),
+	)
+	return count > 0, err
+}
+
+// GetMessageHistory returns one page of a room's messages, oldest first, with
+// cursors for loading the neighbouring pages
+func GetMessageHistory(ctx context.Context, roomID string, query HistoryQuery) (*models.MessagePage, error) {
+	return getHistoryPage(ctx, roomID, bson.M{"room_id": roomID}, query)
+}
+
+// getHistoryPage pages through the messages of a room that match base.
+// Cursors must belong to the room.
+func getHistoryPage(ctx context.Context, roomID string, base bson.M, query HistoryQuery) (*models.MessagePage, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	if limit > MaxHistoryLimit {
+		limit = MaxHistoryLimit
+	}
+
+	if query.ViewerID > 0 {
+		filtered := bson.M{"hidden_for": bson.M{"$ne": query.ViewerID}}
+		for k, v := range base {
+			filtered[k] = v
+		}
+		base = filtered
+	}
+
+	page := &models.MessagePage{}
+	var err error
+
+	switch {
+	case query.Around != "":
+		cur, cerr := resolveCursor(ctx, roomID, query.Around)
+		if cerr != nil {
+			return nil, cerr
+		}
+		var older, newer []models.Message
+		older, page.HasMoreBefore, err = findHistory(ctx, base, cur.older(false), false, limit/2)
+		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, msg)
+		newer, page.HasMoreAfter, err = findHistory(ctx, base, cur.newer(true), true, limit-limit/2)
+		if err != nil {
+			return nil, err
+		}
+		page.Messages = append(older, newer...)
+
+	case query.Before != "":
+		cur, cerr := resolveCursor(ctx, roomID, query.Before)
+		if cerr != nil {
+			return nil, cerr
+		}
+		page.Messages, page.HasMoreBefore, err = findHistory(ctx, base, cur.older(false), false, limit)
+		if err != nil {
+			return nil, err
+		}
+		page.HasMoreAfter, err = historyExists(ctx, base, cur.newer(true))
+
+	case query.After != "":
+		cur, cerr := resolveCursor(ctx, roomID, query.After)
+		if cerr != nil {
+			return nil, cerr
+		}
+		page.Messages, page.HasMoreAfter, err = findHistory(ctx, base, cur.newer(false), true, limit)
+		if err != nil {
+			return nil, err
+		}
+		page.HasMoreBefore, err = historyExists(ctx, base, cur.older(true))
+
+	default:
+		page.Messages, page.HasMoreBefore, err = findHistory(ctx, base, nil, false, limit)
 	}
-	return messages, cur.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if n := len(page.Messages); n > 0 {
+		if page.HasMoreBefore {
+			page.PrevCursor = page.Messages[0].ID.Hex()
+		}
+		if page.HasMoreAfter {
+			page.NextCursor = page.Messages[n-1].ID.Hex()
+		}
+	}
+	return page, nil
 }
 
 // GetAllMessages - Debug function to retrieve all messages
@@ -71,15 +364,6 @@ func GetAllMessages(ctx context.Context) ([]models.Message, error) {
 	return messages, cur.Err()
 }
 
-// DeleteMessage marks a message as deleted
-func DeleteMessage(ctx context.Context, messageID primitive.ObjectID) error {
-	collection := mongodb.ChatDB.Collection("messages")
-	filter := bson.M{"_id": messageID}
-	update := bson.M{"$set": bson.M{"deleted": true}}
-	_, err := collection.UpdateOne(ctx, filter, update)
-	return err
-}
-
 // GetMessageByID retrieves a single message by its ID
 func GetMessageByID(ctx context.Context, messageID primitive.ObjectID) (*models.Message, error) {
 	collection := mongodb.ChatDB.Collection("messages")
@@ -90,109 +374,3 @@ func GetMessageByID(ctx context.Context, messageID primitive.ObjectID) (*models.
 	}
 	return &message, nil
 }
-
-// AddReaction adds a reaction (emoji) from a user to a message
-func AddReaction(ctx context.Context, messageID primitive.ObjectID, emoji, userID string) error {
-	collection := mongodb.ChatDB.Collection("messages")
-	filter := bson.M{"_id": messageID}
-	update := bson.M{
-		"$addToSet": bson.M{
-			"reactions." + emoji: userID, // Adds userID to the emoji array, no duplicates
-		},
-	}
-	_, err := collection.UpdateOne(ctx, filter, update)
-	return err
-}
-
-// RemoveReaction removes a user's reaction (emoji) from a message
-func RemoveReaction(ctx context.Context, messageID primitive.ObjectID, emoji, userID string) error {
-	collection := mongodb.ChatDB.Collection("messages")
-	filter := bson.M{"_id": messageID}
-
-	// First remove the user from the emoji array
-	update := bson.M{
-		"$pull": bson.M{
-			"reactions." + emoji: userID, // Removes userID from the emoji array
-		},
-	}
-	_, err := collection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		return err
-	}
-
-	// Then remove the emoji field if the array is empty
-	// This prevents showing reactions with 0 count
-	cleanupUpdate := bson.M{
-		"$unset": bson.M{
-			"reactions." + emoji: "",
-		},
-	}
-	cleanupFilter := bson.M{
-		"_id":                messageID,
-		"reactions." + emoji: bson.M{"$size": 0}, // Only if array is empty
-	}
-
-	// This update will only execute if the emoji array is empty
-	collection.UpdateOne(ctx, cleanupFilter, cleanupUpdate)
-
-	return nil
-}
-
-// SetUserReaction sets a user's reaction to a message (one reaction per user per message)
-// Returns the previous emoji (if any) and the new emoji for proper WebSocket broadcasting
-func SetUserReaction(ctx context.Context, messageID primitive.ObjectID, newEmoji, userID string) (string, error) {
-	collection := mongodb.ChatDB.Collection("messages")
-
-	// First, get the current message to find any existing reaction from this user
-	var message models.Message
-	err := collection.FindOne(ctx, bson.M{"_id": messageID}).Decode(&message)
-	if err != nil {
-		return "", err
-	}
-
-	var previousEmoji string
-
-	// Find and remove any existing reaction from this user
-	if message.Reactions != nil {
-		for emoji, users := range message.Reactions {
-			for _, uid := range users {
-				if uid == userID {
-					previousEmoji = emoji
-					// Remove user from this emoji's array
-					_, err := collection.UpdateOne(ctx,
-						bson.M{"_id": messageID},
-						bson.M{"$pull": bson.M{"reactions." + emoji: userID}},
-					)
-					if err != nil {
-						return "", err
-					}
-
-					// Clean up empty emoji arrays to prevent showing 0 counts
-					cleanupFilter := bson.M{
-						"_id":                messageID,
-						"reactions." + emoji: bson.M{"$size": 0},
-					}
-					cleanupUpdate := bson.M{
-						"$unset": bson.M{"reactions." + emoji: ""},
-					}
-					collection.UpdateOne(ctx, cleanupFilter, cleanupUpdate)
-					break
-				}
-			}
-			if previousEmoji != "" {
-				break
-			}
-		}
-	}
-
-	// Add the new reaction
-	_, err = collection.UpdateOne(ctx,
-		bson.M{"_id": messageID},
-		bson.M{"$addToSet": bson.M{"reactions." + newEmoji: userID}},
-	)
-	if err != nil {
-		return "", err
-	}
-
-	return previousEmoji, nil
-}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestResolveCursorTimestamp(t *testing.T) {
+	cur, err := resolveCursor(context.Background(), "room_1", "1700000000")
+	if err != nil {
+		t.Fatalf("resolveCursor error = %v", err)
+	}
+	if cur.timestamp != 1700000000 || cur.id != nil {
+		t.Errorf("cursor = %+v, want timestamp 1700000000 without an ID", cur)
+	}
+}
+
+func TestResolveCursorInvalid(t *testing.T) {
+	for _, raw := range []string{"yesterday", "12abc", "1.5", "507f1f77bcf86cd79943901", "99999999999999999999"} {
+		if _, err := resolveCursor(context.Background(), "room_1", raw); err != ErrInvalidCursor {
+			t.Errorf("resolveCursor(%q) error = %v, want ErrInvalidCursor", raw, err)
+		}
+	}
+}
+
+func TestGetMessageHistoryRejectsInvalidCursors(t *testing.T) {
+	for _, query := range []HistoryQuery{{Before: "soon"}, {After: "later"}, {Around: "now"}} {
+		if _, err := GetMessageHistory(context.Background(), "room_1", query); err != ErrInvalidCursor {
+			t.Errorf("GetMessageHistory(%+v) error = %v, want ErrInvalidCursor", query, err)
+		}
+	}
+}
+
+func TestHistoryCursorTimestampOnly(t *testing.T) {
+	cur := historyCursor{timestamp: 100}
+	tests := []struct {
+		got  bson.M
+		want bson.M
+	}{
+		{cur.older(false), bson.M{"timestamp": bson.M{"$lt": int64(100)}}},
+		{cur.older(true), bson.M{"timestamp": bson.M{"$lte": int64(100)}}},
+		{cur.newer(false), bson.M{"timestamp": bson.M{"$gt": int64(100)}}},
+		{cur.newer(true), bson.M{"timestamp": bson.M{"$gte": int64(100)}}},
+	}
+	for i, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("case %d: filter = %v, want %v", i, tt.got, tt.want)
+		}
+	}
+}
+
+func TestHistoryCursorBreaksTimestampTiesByID(t *testing.T) {
+	id := primitive.NewObjectID()
+	cur := historyCursor{timestamp: 100, id: &id}
+
+	// Messages sent in the same second are ordered by ID, so paging never
+	// skips or repeats one of them
+	tieBreak := func(timestampOp, idOp string) bson.M {
+		return bson.M{"$or": bson.A{
+			bson.M{"timestamp": bson.M{timestampOp: int64(100)}},
+			bson.M{"timestamp": int64(100), "_id": bson.M{idOp: id}},
+		}}
+	}
+	tests := []struct {
+		got  bson.M
+		want bson.M
+	}{
+		{cur.older(false), tieBreak("$lt", "$lt")},
+		{cur.older(true), tieBreak("$lt", "$lte")},
+		{cur.newer(false), tieBreak("$gt", "$gt")},
+		{cur.newer(true), tieBreak("$gt", "$gte")},
+	}
+	for i, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("case %d: filter = %v, want %v", i, tt.got, tt.want)
+		}
+	}
+}
+
+func TestValidateClientMsgID(t *testing.T) {
+	for _, id := range []string{"", "a", "msg-1", "3f2b.9c:e_1", strings.Repeat("x", 64)} {
+		if err := ValidateClientMsgID(id); err != nil {
+			t.Errorf("ValidateClientMsgID(%q) error = %v", id, err)
+		}
+	}
+	for _, id := range []string{" ", "has space", "emoji🙂", "a/b", "$where", strings.Repeat("x", 65)} {
+		if err := ValidateClientMsgID(id); err != ErrInvalidClientMsgID {
+			t.Errorf("ValidateClientMsgID(%q) error = %v, want ErrInvalidClientMsgID", id, err)
+		}
+	}
+}
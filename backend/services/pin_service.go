@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxPinnedMessages is the number of messages that can be pinned in one room
+const MaxPinnedMessages = 50
+
+// ErrTooManyPins is returned when a room already has MaxPinnedMessages pins
+var ErrTooManyPins = errors.New("room has reached the pinned message limit")
+
+// CanPinMessage reports whether the user may pin or unpin the message.
+// Room admins always can; the sender can when the room allows it. Either
+// participant of a private room may pin.
+func CanPinMessage(ctx context.Context, msg *models.Message, userID int) (bool, error) {
+	if participants, ok := PrivateRoomParticipants(msg.RoomID); ok {
+		return participants[0] == userID || participants[1] == userID, nil
+	}
+
+	member, err := GetRoomMember(ctx, msg.RoomID, userID)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if member.Role == models.RoomRoleAdmin {
+		return true, nil
+	}
+	if msg.SenderID != userID {
+		return false, nil
+	}
+
+	room, err := GetRoom(ctx, msg.RoomID)
+	if err != nil {
+		return false, err
+	}
+	return room.Policy.SendersCanPin, nil
+}
+
+// PinMessage pins a message in its room and returns the updated message.
+// A slot is reserved on the room's pinned_count first so concurrent pins
+// cannot push the room past MaxPinnedMessages.
+func PinMessage(ctx context.Context, messageID primitive.ObjectID, roomID string, userID int) (*models.Message, error) {
+	collection := mongodb.ChatDB.Collection("messages")
+
+	reserved, err := mongodb.ChatDB.Collection("rooms").UpdateOne(ctx,
+		bson.M{"_id": roomID, "pinned_count": bson.M{"$not": bson.M{"$gte": MaxPinnedMessages}}},
+		bson.M{"$inc": bson.M{"pinned_count": 1}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if reserved.MatchedCount == 0 {
+		return nil, ErrTooManyPins
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var message models.Message
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": messageID, "room_id": roomID, "deleted": false, "pinned": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{
+			"pinned":    true,
+			"pinned_by": userID,
+			"pinned_at": time.Now().Unix(),
+		}},
+		opts,
+	).Decode(&message)
+	if err == nil {
+		return &message, nil
+	}
+
+	// The slot was not used: give it back before reporting the outcome
+	if releaseErr := releasePins(ctx, roomID, 1); releaseErr != nil {
+		return nil, releaseErr
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	// Pinning an already pinned message leaves it as it is
+	err = collection.FindOne(ctx, bson.M{"_id": messageID, "room_id": roomID, "deleted": false, "pinned": true}).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// UnpinMessage removes a message's pin
+func UnpinMessage(ctx context.Context, messageID primitive.ObjectID) error {
+	collection := mongodb.ChatDB.Collection("messages")
+	opts := options.FindOneAndUpdate().SetProjection(bson.M{"room_id": 1})
+	var message models.Message
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": messageID, "pinned": true, "deleted": false},
+		bson.M{"$unset": bson.M{"pinned": "", "pinned_by": "", "pinned_at": ""}},
+		opts,
+	).Decode(&message)
+	if err != nil {
+		return err
+	}
+	return releasePins(ctx, message.RoomID, 1)
+}
+
+// releasePins gives back n of a room's pinned_count slots
+func releasePins(ctx context.Context, roomID string, n int) error {
+	_, err := mongodb.ChatDB.Collection("rooms").UpdateOne(ctx,
+		bson.M{"_id": roomID, "pinned_count": bson.M{"$gte": n}},
+		bson.M{"$inc": bson.M{"pinned_count": -n}},
+	)
+	return err
+}
+
+// GetPinnedMessages returns a room's pinned messages, most recently pinned first
+func GetPinnedMessages(ctx context.Context, roomID string) ([]models.Message, error) {
+	collection := mongodb.ChatDB.Collection("messages")
+
+	opts := options.Find().SetSort(bson.D{primitive.E{Key: "pinned_at", Value: -1}})
+	cur, err := collection.Find(ctx, bson.M{"room_id": roomID, "pinned": true, "deleted": false}, opts)
+	if err != nil {
+		return nil, err
+	}
+	messages := []models.Message{}
+	if err := cur.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
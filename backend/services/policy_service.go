@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"go-react-chat/kalpesh-vala/github.com/db/redis"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Posting policy violation codes
+const (
+	PolicySlowMode            = "slow_mode"
+	PolicyAnnouncementOnly    = "announcement_only"
+	PolicyAttachmentsDisabled = "attachments_disabled"
+)
+
+// PolicyError describes a message rejected by a room's posting policy
+type PolicyError struct {
+	Code       string
+	Message    string
+	RetryAfter int64 // seconds until the user may post again, set for slow mode
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+// EnforcePostingPolicy checks a new message against the room's posting policy.
+// It returns a *PolicyError when the message must be rejected. Room admins are
+// exempt from slow mode and announcement-only restrictions. In slow mode an
+// accepted message takes the user's slot; call ReleasePostingSlot if it is
+// then not stored.
+func EnforcePostingPolicy(ctx context.Context, roomID string, userID int, hasAttachment bool) error {
+	room, err := GetRoom(ctx, roomID)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	policy := room.Policy
+
+	if hasAttachment && policy.AttachmentsDisabled {
+		return &PolicyError{Code: PolicyAttachmentsDisabled, Message: "Attachments are not allowed in this room"}
+	}
+
+	if !policy.AnnouncementOnly && policy.SlowModeSeconds <= 0 {
+		return nil
+	}
+
+	isAdmin, err := IsRoomAdmin(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if isAdmin {
+		return nil
+	}
+
+	if policy.AnnouncementOnly {
+		return &PolicyError{Code: PolicyAnnouncementOnly, Message: "Only room admins can post in this room"}
+	}
+
+	interval := time.Duration(policy.SlowModeSeconds) * time.Second
+	ok, wait, err := redis.AcquireSlowModeSlot(roomID, strconv.Itoa(userID), interval)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		retryAfter := int64(wait.Round(time.Second) / time.Second)
+		return &PolicyError{
+			Code:       PolicySlowMode,
+			Message:    fmt.Sprintf("Slow mode is on, wait %d seconds before posting again", retryAfter),
+			RetryAfter: retryAfter,
+		}
+	}
+	return nil
+}
+
+// ReleasePostingSlot gives back the slow mode slot EnforcePostingPolicy took
+// for a message that could not be stored, so the user can retry at once
+func ReleasePostingSlot(roomID string, userID int) {
+	if err := redis.ReleaseSlowModeSlot(roomID, strconv.Itoa(userID)); err != nil {
+		log.Println("Failed to release slow mode slot:", err)
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Poll size limits
+const (
+	MinPollOptions        = 2
+	MaxPollOptions        = 10
+	maxPollQuestionLength = 300
+	maxPollOptionLength   = 100
+)
+
+var (
+	// ErrPollQuestion is returned when a poll's question is missing or too long
+	ErrPollQuestion = errors.New("poll question is required and must be at most 300 characters")
+	// ErrPollOptions is returned when a poll has too few, too many or repeated options
+	ErrPollOptions = errors.New("a poll needs between 2 and 10 distinct options of at most 100 characters")
+	// ErrPollClosesAt is returned when a poll would close in the past
+	ErrPollClosesAt = errors.New("closes_at must be in the future")
+	// ErrNotAPoll is returned when voting on a message that is not a poll
+	ErrNotAPoll = errors.New("message is not a poll")
+	// ErrPollClosed is returned when voting on or closing a poll that is already closed
+	ErrPollClosed = errors.New("poll is closed")
+	// ErrInvalidVote is returned when a vote names unknown options or too many of them
+	ErrInvalidVote = errors.New("vote must pick options from this poll, and only one unless it is multiple choice")
+	// ErrNotPollOwner is returned when someone other than the creator or a room admin closes a poll
+	ErrNotPollOwner = errors.New("only the poll creator or a room admin can close this poll")
+)
+
+// PollRequest describes a new poll
+type PollRequest struct {
+	RoomID         string
+	CreatorID      int
+	Question       string
+	Options        []string
+	MultipleChoice bool
+	Anonymous      bool
+	ClosesAt       int64
+}
+
+// CreatePoll validates a poll and stores it as a poll message
+func CreatePoll(ctx context.Context, req PollRequest) (*models.Message, error) {
+	question := strings.TrimSpace(req.Question)
+	if question == "" || utf8.RuneCountInString(question) > maxPollQuestionLength {
+		return nil, ErrPollQuestion
+	}
+	if len(req.Options) < MinPollOptions || len(req.Options) > MaxPollOptions {
+		return nil, ErrPollOptions
+	}
+	if req.ClosesAt != 0 && req.ClosesAt <= time.Now().Unix() {
+		return nil, ErrPollClosesAt
+	}
+
+	pollOptions := make([]models.PollOption, 0, len(req.Options))
+	seen := map[string]bool{}
+	for i, text := range req.Options {
+		text = strings.TrimSpace(text)
+		key := strings.ToLower(text)
+		if text == "" || utf8.RuneCountInString(text) > maxPollOptionLength || seen[key] {
+			return nil, ErrPollOptions
+		}
+		seen[key] = true
+		pollOptions = append(pollOptions, models.PollOption{ID: strconv.Itoa(i + 1), Text: text})
+	}
+
+	isGroup, err := roomIsGroup(ctx, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	msg := models.Message{
+		RoomID:      req.RoomID,
+		SenderID:    req.CreatorID,
+		Message:     question,
+		IsGroup:     isGroup,
+		Status:      models.MessageStatusSent,
+		MessageType: models.MessageTypePoll,
+		Deleted:     false,
+		Poll: &models.Poll{
+			Question:       question,
+			Options:        pollOptions,
+			MultipleChoice: req.MultipleChoice,
+			Anonymous:      req.Anonymous,
+			CreatedBy:      req.CreatorID,
+			ClosesAt:       req.ClosesAt,
+		},
+	}
+	if err := InsertMessage(ctx, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// getPollMessage loads a message and checks that it is a live poll
+func getPollMessage(ctx context.Context, messageID primitive.ObjectID) (*models.Message, error) {
+	msg, err := GetMessageByID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.MessageType != models.MessageTypePoll || msg.Poll == nil {
+		return nil, ErrNotAPoll
+	}
+	if msg.Deleted {
+		return nil, ErrMessageDeleted
+	}
+	return msg, nil
+}
+
+// VotePoll records a room member's choice on a poll, replacing any earlier
+// vote. An empty optionIDs withdraws the vote. It returns the updated poll message.
+func VotePoll(ctx context.Context, messageID primitive.ObjectID, userID int, optionIDs []string) (*models.Message, error) {
+	msg, err := getPollMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := CanPostToRoom(ctx, msg.RoomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrNotRoomMember
+	}
+	now := time.Now().Unix()
+	if msg.Poll.IsClosed(now) {
+		return nil, ErrPollClosed
+	}
+
+	valid := make(map[string]bool, len(msg.Poll.Options))
+	for _, opt := range msg.Poll.Options {
+		valid[opt.ID] = true
+	}
+	picked := map[string]bool{}
+	for _, id := range optionIDs {
+		if !valid[id] || picked[id] {
+			return nil, ErrInvalidVote
+		}
+		picked[id] = true
+	}
+	if len(optionIDs) > 1 && !msg.Poll.MultipleChoice {
+		return nil, ErrInvalidVote
+	}
+
+	voteKey := "poll.votes." + strconv.Itoa(userID)
+	update := bson.M{"$set": bson.M{voteKey: optionIDs}}
+	if len(optionIDs) == 0 {
+		update = bson.M{"$unset": bson.M{voteKey: ""}}
+	}
+	return updateOpenPoll(ctx, messageID, now, update)
+}
+
+// ClosePoll stops a poll from taking more votes. Only the poll's creator or a
+// room admin may close it.
+func ClosePoll(ctx context.Context, messageID primitive.ObjectID, userID int) (*models.Message, error) {
+	msg, err := getPollMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if msg.Poll.IsClosed(now) {
+		return nil, ErrPollClosed
+	}
+	if msg.Poll.CreatedBy != userID {
+		isAdmin, err := IsRoomAdmin(ctx, msg.RoomID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !isAdmin {
+			return nil, ErrNotPollOwner
+		}
+	}
+	return updateOpenPoll(ctx, messageID, now, bson.M{"$set": bson.M{"poll.closed_at": now}})
+}
+
+// updateOpenPoll applies an update only while the poll is still open, so a
+// vote racing with the close time or a close request is rejected
+func updateOpenPoll(ctx context.Context, messageID primitive.ObjectID, now int64, update bson.M) (*models.Message, error) {
+	filter := bson.M{
+		"_id":            messageID,
+		"deleted":        false,
+		"poll.closed_at": bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"poll.closes_at": bson.M{"$exists": false}},
+			bson.M{"poll.closes_at": bson.M{"$gt": now}},
+		},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated models.Message
+	err := mongodb.ChatDB.Collection("messages").FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPollClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"context"
+
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SetLinkPreviews attaches link previews to a message. content is the text
+// the previews were built from; if the message was edited or deleted since,
+// nothing is stored and false is returned.
+func SetLinkPreviews(ctx context.Context, messageID primitive.ObjectID, content string, previews []models.LinkPreview) (bool, error) {
+	res, err := mongodb.ChatDB.Collection("messages").UpdateOne(ctx,
+		bson.M{"_id": messageID, "message": content, "deleted": false},
+		bson.M{"$set": bson.M{"previews": previews}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReactionEmoji is the set of standard emoji users may react with. Custom
+// emoji can be used too, written as :shortcode:.
+var ReactionEmoji = []string{
+	"👍", "👎", "❤️", "😂", "😮", "😢", "😡", "🎉", "🙏", "🔥", "👀", "✅", "💯", "🚀", "👏", "🤔",
+}
+
+var allowedReactions = func() map[string]bool {
+	allowed := make(map[string]bool, len(ReactionEmoji))
+	for _, emoji := range ReactionEmoji {
+		allowed[emoji] = true
+	}
+	return allowed
+}()
+
+var (
+	// ErrInvalidReaction is returned for emoji outside the supported set
+	ErrInvalidReaction = errors.New("emoji is not a supported reaction")
+	// ErrInvalidReactor is returned when a reaction's user ID is not a positive number
+	ErrInvalidReactor = errors.New("user_id must be a positive number")
+)
+
+// ValidateReaction checks that an emoji may be used as a reaction: either one
+// of ReactionEmoji or an existing custom emoji written as :shortcode:
+func ValidateReaction(ctx context.Context, emoji string) error {
+	if allowedReactions[emoji] {
+		return nil
+	}
+	if len(emoji) < 2 || !strings.HasPrefix(emoji, ":") || !strings.HasSuffix(emoji, ":") {
+		return ErrInvalidReaction
+	}
+	shortcode, err := NormalizeShortcode(emoji)
+	if err != nil || ":"+shortcode+":" != emoji {
+		return ErrInvalidReaction
+	}
+	exists, err := customEmojiExists(ctx, shortcode)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrInvalidReaction
+	}
+	return nil
+}
+
+// reactionField is the field path of a user's reaction. User IDs are checked
+// to be numeric, so nothing from the request can change the path.
+func reactionField(userID string) (string, error) {
+	if id, err := strconv.Atoi(userID); err != nil || id <= 0 || strconv.Itoa(id) != userID {
+		return "", ErrInvalidReactor
+	}
+	return "user_reactions." + userID, nil
+}
+
+// SetUserReaction sets a user's reaction to a message, replacing any earlier
+// one in the same update, and returns the emoji it replaced, if any
+func SetUserReaction(ctx context.Context, messageID primitive.ObjectID, emoji, userID string) (string, error) {
+	if err := ValidateReaction(ctx, emoji); err != nil {
+		return "", err
+	}
+	field, err := reactionField(userID)
+	if err != nil {
+		return "", err
+	}
+
+	opts := options.FindOneAndUpdate().
+		SetProjection(bson.M{field: 1}).
+		SetReturnDocument(options.Before)
+	var before models.Message
+	err = mongodb.ChatDB.Collection("messages").FindOneAndUpdate(ctx,
+		bson.M{"_id": messageID, "deleted": false},
+		bson.M{"$set": bson.M{field: emoji}},
+		opts,
+	).Decode(&before)
+	if err != nil {
+		return "", err
+	}
+	return before.UserReactions[userID], nil
+}
+
+// RemoveReaction removes a user's reaction if it is still the given emoji.
+// It reports whether a reaction was removed.
+func RemoveReaction(ctx context.Context, messageID primitive.ObjectID, emoji, userID string) (bool, error) {
+	field, err := reactionField(userID)
+	if err != nil {
+		return false, err
+	}
+	result, err := mongodb.ChatDB.Collection("messages").UpdateOne(ctx,
+		bson.M{"_id": messageID, field: emoji},
+		bson.M{"$unset": bson.M{field: ""}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// GetReactionSummary counts a message's reactions per emoji, most used first,
+// and returns one page of the users who reacted, optionally only with emoji
+func GetReactionSummary(msg *models.Message, emoji string, page, limit int) ([]models.ReactionCount, []models.Reactor, int) {
+	counts := []models.ReactionCount{}
+	for e, users := range msg.ReactionGroups() {
+		counts = append(counts, models.ReactionCount{Emoji: e, Count: len(users)})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Emoji < counts[j].Emoji
+	})
+
+	reactors := []models.Reactor{}
+	for id, e := range msg.UserReactions {
+		if emoji != "" && e != emoji {
+			continue
+		}
+		userID, _ := strconv.Atoi(id)
+		reactors = append(reactors, models.Reactor{UserID: userID, Emoji: e})
+	}
+	sort.Slice(reactors, func(i, j int) bool { return reactors[i].UserID < reactors[j].UserID })
+
+	total := len(reactors)
+	start := (page - 1) * limit
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+	return counts, reactors[start:end], total
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-react-chat/kalpesh-vala/github.com/models"
+)
+
+func TestValidateReactionStandardEmoji(t *testing.T) {
+	for _, emoji := range ReactionEmoji {
+		if err := ValidateReaction(context.Background(), emoji); err != nil {
+			t.Errorf("ValidateReaction(%q) error = %v", emoji, err)
+		}
+	}
+}
+
+func TestValidateReactionRejectsWithoutLookup(t *testing.T) {
+	// None of these may reach the custom emoji lookup
+	for _, emoji := range []string{
+		"",
+		"🦄",
+		"👍👍",
+		"thumbsup",
+		":",
+		"::",
+		":party",
+		"party:",
+		":Party:",
+		":has space:",
+		": party:",
+		":a:",
+		":$where:",
+		":" + strings.Repeat("a", 33) + ":",
+	} {
+		if err := ValidateReaction(context.Background(), emoji); err != ErrInvalidReaction {
+			t.Errorf("ValidateReaction(%q) error = %v, want ErrInvalidReaction", emoji, err)
+		}
+	}
+}
+
+func TestNormalizeShortcode(t *testing.T) {
+	tests := map[string]string{
+		"party":      "party",
+		":party:":    "party",
+		" :+1: ":     "+1",
+		"big_smile-": "big_smile-",
+	}
+	for raw, want := range tests {
+		if got, err := NormalizeShortcode(raw); err != nil || got != want {
+			t.Errorf("NormalizeShortcode(%q) = %q, %v, want %q", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"", "a", "Party", "has space", "emoji!", ":" + strings.Repeat("a", 33) + ":"} {
+		if _, err := NormalizeShortcode(raw); err != ErrInvalidShortcode {
+			t.Errorf("NormalizeShortcode(%q) error = %v, want ErrInvalidShortcode", raw, err)
+		}
+	}
+}
+
+func TestReactionField(t *testing.T) {
+	field, err := reactionField("42")
+	if err != nil || field != "user_reactions.42" {
+		t.Errorf("reactionField(\"42\") = %q, %v", field, err)
+	}
+
+	for _, userID := range []string{"", "0", "-1", "042", "+42", "4.2", "1e3", "42 ", "a", "$set", "42.pinned", "99999999999999999999"} {
+		if _, err := reactionField(userID); err != ErrInvalidReactor {
+			t.Errorf("reactionField(%q) error = %v, want ErrInvalidReactor", userID, err)
+		}
+	}
+}
+
+func TestGetReactionSummary(t *testing.T) {
+	msg := &models.Message{UserReactions: map[string]string{
+		"3": "👍",
+		"1": "👍",
+		"2": "🎉",
+		"4": "❤️",
+		"5": "👍",
+	}}
+
+	counts, reactors, total := GetReactionSummary(msg, "", 1, 2)
+	wantCounts := []models.ReactionCount{{Emoji: "👍", Count: 3}, {Emoji: "❤️", Count: 1}, {Emoji: "🎉", Count: 1}}
+	if !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("counts = %v, want %v", counts, wantCounts)
+	}
+	wantReactors := []models.Reactor{{UserID: 1, Emoji: "👍"}, {UserID: 2, Emoji: "🎉"}}
+	if total != 5 || !reflect.DeepEqual(reactors, wantReactors) {
+		t.Errorf("page 1 = %v of %d, want %v of 5", reactors, total, wantReactors)
+	}
+
+	_, reactors, total = GetReactionSummary(msg, "👍", 2, 2)
+	if total != 3 || !reflect.DeepEqual(reactors, []models.Reactor{{UserID: 5, Emoji: "👍"}}) {
+		t.Errorf("filtered page 2 = %v of %d", reactors, total)
+	}
+
+	_, reactors, total = GetReactionSummary(msg, "", 9, 2)
+	if total != 5 || len(reactors) != 0 {
+		t.Errorf("page past the end = %v of %d, want none of 5", reactors, total)
+	}
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// advanceDelivered moves the members' delivered position forward to messageID
+func advanceDelivered(ctx context.Context, roomID string, userIDs []int, messageID primitive.ObjectID) error {
+	_, err := mongodb.ChatDB.Collection("room_members").UpdateMany(ctx,
+		bson.M{
+			"room_id": roomID,
+			"user_id": bson.M{"$in": userIDs},
+			"$or": bson.A{
+				bson.M{"last_delivered_message_id": bson.M{"$exists": false}},
+				bson.M{"last_delivered_message_id": bson.M{"$lt": messageID}},
+			},
+		},
+		bson.M{"$set": bson.M{"last_delivered_message_id": messageID}},
+	)
+	return err
+}
+
+// MarkDelivered records that a message reached the given recipients' connections.
+// It returns true when a private message's status moved from sent to delivered.
+func MarkDelivered(ctx context.Context, msg *models.Message, recipientIDs []int) (bool, error) {
+	if len(recipientIDs) == 0 {
+		return false, nil
+	}
+	if err := advanceDelivered(ctx, msg.RoomID, recipientIDs, msg.ID); err != nil {
+		return false, err
+	}
+
+	if _, ok := PrivateRoomParticipants(msg.RoomID); !ok {
+		return false, nil
+	}
+	result, err := mongodb.ChatDB.Collection("messages").UpdateOne(ctx,
+		bson.M{"_id": msg.ID, "status": models.MessageStatusSent},
+		bson.M{"$set": bson.M{"status": models.MessageStatusDelivered}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// recordRead updates delivery state after a member's read position moved to messageID.
+// Reading implies delivery, and in private rooms the other side's messages become read.
+func recordRead(ctx context.Context, roomID string, userID int, messageID primitive.ObjectID) error {
+	if err := advanceDelivered(ctx, roomID, []int{userID}, messageID); err != nil {
+		return err
+	}
+
+	if _, ok := PrivateRoomParticipants(roomID); !ok {
+		return nil
+	}
+	_, err := mongodb.ChatDB.Collection("messages").UpdateMany(ctx,
+		bson.M{
+			"room_id":   roomID,
+			"_id":       bson.M{"$lte": messageID},
+			"sender_id": bson.M{"$ne": userID},
+			"status":    bson.M{"$ne": models.MessageStatusRead},
+		},
+		bson.M{"$set": bson.M{"status": models.MessageStatusRead}},
+	)
+	return err
+}
+
+// GetMessageReceipts lists the members, other than the sender, whose delivered
+// and read positions have reached the message
+func GetMessageReceipts(ctx context.Context, msg *models.Message) (*models.MessageReceipts, error) {
+	cur, err := mongodb.ChatDB.Collection("room_members").Find(ctx, bson.M{
+		"room_id": msg.RoomID,
+		"user_id": bson.M{"$ne": msg.SenderID},
+		"$or": bson.A{
+			bson.M{"last_delivered_message_id": bson.M{"$gte": msg.ID}},
+			bson.M{"last_read_message_id": bson.M{"$gte": msg.ID}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var members []models.RoomMember
+	if err := cur.All(ctx, &members); err != nil {
+		return nil, err
+	}
+
+	receipts := &models.MessageReceipts{
+		MessageID:   msg.ID.Hex(),
+		DeliveredTo: []int{},
+		ReadBy:      []int{},
+	}
+	for _, m := range members {
+		receipts.DeliveredTo = append(receipts.DeliveredTo, m.UserID)
+		if m.LastReadMessageID != nil && bytes.Compare(m.LastReadMessageID[:], msg.ID[:]) >= 0 {
+			receipts.ReadBy = append(receipts.ReadBy, m.UserID)
+		}
+	}
+	return receipts, nil
+}
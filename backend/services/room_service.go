@@ -0,0 +1,715 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"regexp"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrRoomNotJoinable is returned when a user tries to join or leave a room that does not allow it
+var ErrRoomNotJoinable = errors.New("room cannot be joined or left by its members")
+
+// ErrNotRoomMember is returned when a room action requires membership the user does not have
+var ErrNotRoomMember = errors.New("you are not a member of this room")
+
+// ErrReadMessageNotInRoom is returned when a read position names a message from another room
+var ErrReadMessageNotInRoom = errors.New("message_id must be a message in this room")
+
+// previewLength is the maximum number of characters kept in a room's last message preview
+const previewLength = 100
+
+// PrivateRoomParticipants returns both user IDs of a "private_<a>_<b>" room
+func PrivateRoomParticipants(roomID string) ([]int, bool) {
+	var a, b int
+	var rest string
+	n, _ := fmt.Sscanf(roomID, "private_%d_%d%s", &a, &b, &rest)
+	if n != 2 || a <= 0 || b <= 0 {
+		return nil, false
+	}
+	return []int{a, b}, true
+}
+
+// roomIsGroup reports whether messages to the room are group messages. Rooms
+// that do not exist yet are treated as groups unless they are direct messages.
+func roomIsGroup(ctx context.Context, roomID string) (bool, error) {
+	if _, ok := PrivateRoomParticipants(roomID); ok {
+		return false, nil
+	}
+	room, err := GetRoom(ctx, roomID)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return room.IsGroup, nil
+}
+
+// PreviewText shortens message content for conversation lists and notifications
+func PreviewText(content string) string {
+	if utf8.RuneCountInString(content) > previewLength {
+		return string([]rune(content)[:previewLength]) + "…"
+	}
+	return content
+}
+
+// buildPreview shortens a message to what the conversation list needs
+func buildPreview(msg *models.Message) *models.MessagePreview {
+	return &models.MessagePreview{
+		MessageID:     msg.ID,
+		SenderID:      msg.SenderID,
+		Content:       PreviewText(msg.Message),
+		Timestamp:     msg.Timestamp,
+		HasAttachment: msg.AttachmentURL != "",
+	}
+}
+
+// recordRoomActivity updates the room summary and unread counters after a message is stored.
+// Direct message rooms are created here with their first message; other rooms
+// are created with POST /rooms before anyone can post to them.
+func recordRoomActivity(ctx context.Context, msg *models.Message) error {
+	rooms := mongodb.ChatDB.Collection("rooms")
+	members := mongodb.ChatDB.Collection("room_members")
+
+	participants, isDirect := PrivateRoomParticipants(msg.RoomID)
+	_, err := rooms.UpdateOne(ctx,
+		bson.M{"_id": msg.RoomID},
+		bson.M{
+			"$set": bson.M{
+				"last_message":  buildPreview(msg),
+				"last_activity": msg.Timestamp,
+			},
+			"$setOnInsert": bson.M{
+				"is_group":     msg.IsGroup,
+				"visibility":   models.RoomVisibilityPrivate,
+				"member_count": 0,
+				"created_at":   msg.Timestamp,
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+
+	if isDirect {
+		// Both sides of a private room are members as soon as it has a message
+		for _, uid := range participants {
+			if _, err := addRoomMember(ctx, msg.RoomID, uid, models.RoomRoleMember, msg.Timestamp); err != nil {
+				return err
+			}
+		}
+	} else {
+		// Posting to a public room joins it; members of other rooms are already in
+		if _, err := addRoomMember(ctx, msg.RoomID, msg.SenderID, models.RoomRoleMember, msg.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	// The sender has read everything up to their own message
+	_, err = members.UpdateOne(ctx,
+		bson.M{"room_id": msg.RoomID, "user_id": msg.SenderID},
+		bson.M{"$set": bson.M{
+			"last_read_message_id": msg.ID,
+			"last_read_at":         msg.Timestamp,
+			"unread_count":         0,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// System messages announce changes to the room and never count as unread
+	if msg.MessageType != models.MessageTypeSystem {
+		_, err = members.UpdateMany(ctx,
+			bson.M{"room_id": msg.RoomID, "user_id": bson.M{"$ne": msg.SenderID}},
+			bson.M{"$inc": bson.M{"unread_count": 1}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// New activity brings archived rooms back, unless the member muted them
+	_, err = members.UpdateMany(ctx,
+		bson.M{
+			"room_id":  msg.RoomID,
+			"archived": true,
+			"$or": bson.A{
+				bson.M{"muted_until": bson.M{"$exists": false}},
+				bson.M{"muted_until": bson.M{"$lte": msg.Timestamp}},
+			},
+		},
+		bson.M{"$unset": bson.M{"archived": ""}},
+	)
+	return err
+}
+
+// unreadFilter matches the messages after a read position that count as
+// unread for a user: other people's messages that are not deleted, system
+// messages or hidden by the user
+func unreadFilter(roomID string, userID int, after primitive.ObjectID) bson.M {
+	return bson.M{
+		"room_id":      roomID,
+		"_id":          bson.M{"$gt": after},
+		"sender_id":    bson.M{"$ne": userID},
+		"deleted":      false,
+		"message_type": bson.M{"$ne": models.MessageTypeSystem},
+		"hidden_for":   bson.M{"$ne": userID},
+	}
+}
+
+// discountUnread takes a message that stopped counting as unread, because it
+// was deleted or hidden, off the unread counts of the members it was counted
+// for and who have not read it yet. A non-nil userIDs limits this to those members.
+func discountUnread(ctx context.Context, msg *models.Message, userIDs []int) error {
+	if msg.Deleted || msg.MessageType == models.MessageTypeSystem {
+		return nil
+	}
+	// Members who hid the message were already discounted
+	excluded := append([]int{msg.SenderID}, msg.HiddenFor...)
+	users := bson.M{"$nin": excluded}
+	if userIDs != nil {
+		users["$in"] = userIDs
+	}
+	_, err := mongodb.ChatDB.Collection("room_members").UpdateMany(ctx,
+		bson.M{
+			"room_id":      msg.RoomID,
+			"user_id":      users,
+			"unread_count": bson.M{"$gt": 0},
+			"joined_at":    bson.M{"$lte": msg.Timestamp},
+			"$or": bson.A{
+				bson.M{"last_read_message_id": bson.M{"$exists": false}},
+				bson.M{"last_read_message_id": bson.M{"$lt": msg.ID}},
+			},
+		},
+		bson.M{"$inc": bson.M{"unread_count": -1}},
+	)
+	return err
+}
+
+// refreshRoomPreview updates the room's last message preview if msg is that message
+func refreshRoomPreview(ctx context.Context, msg *models.Message) error {
+	_, err := mongodb.ChatDB.Collection("rooms").UpdateOne(ctx,
+		bson.M{"_id": msg.RoomID, "last_message.message_id": msg.ID},
+		bson.M{"$set": bson.M{"last_message": buildPreview(msg)}},
+	)
+	return err
+}
+
+// addRoomMember adds a user to a room if they are not already a member.
+// It returns true when a new membership was created.
+func addRoomMember(ctx context.Context, roomID string, userID int, role string, joinedAt int64) (bool, error) {
+	result, err := mongodb.ChatDB.Collection("room_members").UpdateOne(ctx,
+		bson.M{"room_id": roomID, "user_id": userID},
+		bson.M{"$setOnInsert": bson.M{
+			"role":         role,
+			"unread_count": 0,
+			"joined_at":    joinedAt,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.UpsertedCount == 0 {
+		return false, nil
+	}
+
+	_, err = mongodb.ChatDB.Collection("rooms").UpdateOne(ctx,
+		bson.M{"_id": roomID},
+		bson.M{"$inc": bson.M{"member_count": 1}},
+	)
+	return true, err
+}
+
+// CreateRoom stores a new group room and makes its creator an admin
+func CreateRoom(ctx context.Context, room *models.Room) error {
+	now := time.Now().Unix()
+	room.ID = "room_" + primitive.NewObjectID().Hex()
+	room.IsGroup = true
+	room.MemberCount = 0
+	room.CreatedAt = now
+	room.LastActivity = now
+	if room.Visibility == "" {
+		room.Visibility = models.RoomVisibilityPrivate
+	}
+
+	if _, err := mongodb.ChatDB.Collection("rooms").InsertOne(ctx, room); err != nil {
+		return err
+	}
+	if _, err := addRoomMember(ctx, room.ID, room.CreatedBy, models.RoomRoleAdmin, now); err != nil {
+		return err
+	}
+	room.MemberCount = 1
+	return nil
+}
+
+// GetRoom retrieves a room by its ID
+func GetRoom(ctx context.Context, roomID string) (*models.Room, error) {
+	var room models.Room
+	err := mongodb.ChatDB.Collection("rooms").FindOne(ctx, bson.M{"_id": roomID}).Decode(&room)
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// UpdateRoom applies the given field changes to a room and returns the updated room
+func UpdateRoom(ctx context.Context, roomID string, changes bson.M) (*models.Room, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var room models.Room
+	err := mongodb.ChatDB.Collection("rooms").FindOneAndUpdate(ctx,
+		bson.M{"_id": roomID},
+		bson.M{"$set": changes},
+		opts,
+	).Decode(&room)
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// GetRoomMember returns the user's membership in a room
+func GetRoomMember(ctx context.Context, roomID string, userID int) (*models.RoomMember, error) {
+	var member models.RoomMember
+	err := mongodb.ChatDB.Collection("room_members").FindOne(ctx, bson.M{"room_id": roomID, "user_id": userID}).Decode(&member)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// IsRoomMember reports whether the user belongs to the room
+func IsRoomMember(ctx context.Context, roomID string, userID int) (bool, error) {
+	_, err := GetRoomMember(ctx, roomID, userID)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// IsRoomAdmin reports whether the user administers the room
+func IsRoomAdmin(ctx context.Context, roomID string, userID int) (bool, error) {
+	member, err := GetRoomMember(ctx, roomID, userID)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return member.Role == models.RoomRoleAdmin, nil
+}
+
+// CanReadRoom reports whether the user may read the room's messages.
+// Public rooms are readable by everyone; other rooms only by their members.
+func CanReadRoom(ctx context.Context, roomID string, userID int) (bool, error) {
+	if participants, ok := PrivateRoomParticipants(roomID); ok {
+		return participants[0] == userID || participants[1] == userID, nil
+	}
+
+	room, err := GetRoom(ctx, roomID)
+	if err == mongo.ErrNoDocuments {
+		// The room has not been created yet; it will be on its first message
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if room.IsPublic() {
+		return true, nil
+	}
+	return IsRoomMember(ctx, roomID, userID)
+}
+
+// CanPostToRoom reports whether the user may send messages to the room.
+// Anyone may post to public rooms, and joins them by posting; other rooms
+// require membership.
+func CanPostToRoom(ctx context.Context, roomID string, userID int) (bool, error) {
+	if participants, ok := PrivateRoomParticipants(roomID); ok {
+		return participants[0] == userID || participants[1] == userID, nil
+	}
+
+	// Group rooms must be created before they take messages, so posting
+	// first to an unused room ID does not create or claim it
+	room, err := GetRoom(ctx, roomID)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if room.IsPublic() {
+		return true, nil
+	}
+	return IsRoomMember(ctx, roomID, userID)
+}
+
+// JoinRoom adds the user to a public or unlisted room
+func JoinRoom(ctx context.Context, roomID string, userID int) (*models.Room, error) {
+	room, err := GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !room.IsJoinable() {
+		return nil, ErrRoomNotJoinable
+	}
+	if _, err := addRoomMember(ctx, roomID, userID, models.RoomRoleMember, time.Now().Unix()); err != nil {
+		return nil, err
+	}
+	return GetRoom(ctx, roomID)
+}
+
+// ErrInviteNotAllowed is returned when a member who is not an admin invites someone to a private room
+var ErrInviteNotAllowed = errors.New("only room admins can invite to a private room")
+
+// InviteToRoom adds a user to a group room on behalf of one of its members.
+// Any member may invite to public and unlisted rooms; private rooms need an
+// admin. It returns false when the user was already a member.
+func InviteToRoom(ctx context.Context, roomID string, inviterID, userID int) (bool, error) {
+	if _, ok := PrivateRoomParticipants(roomID); ok {
+		return false, ErrRoomNotJoinable
+	}
+	room, err := GetRoom(ctx, roomID)
+	if err != nil {
+		return false, err
+	}
+	inviter, err := GetRoomMember(ctx, roomID, inviterID)
+	if err == mongo.ErrNoDocuments {
+		return false, ErrNotRoomMember
+	}
+	if err != nil {
+		return false, err
+	}
+	if !room.IsJoinable() && inviter.Role != models.RoomRoleAdmin {
+		return false, ErrInviteNotAllowed
+	}
+	return addRoomMember(ctx, roomID, userID, models.RoomRoleMember, time.Now().Unix())
+}
+
+// LeaveRoom removes the user from a room
+func LeaveRoom(ctx context.Context, roomID string, userID int) error {
+	if _, ok := PrivateRoomParticipants(roomID); ok {
+		return ErrRoomNotJoinable
+	}
+
+	result, err := mongodb.ChatDB.Collection("room_members").DeleteOne(ctx, bson.M{"room_id": roomID, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	_, err = mongodb.ChatDB.Collection("rooms").UpdateOne(ctx,
+		bson.M{"_id": roomID},
+		bson.M{"$inc": bson.M{"member_count": -1}},
+	)
+	return err
+}
+
+// ListPublicRooms searches the public room directory by name and topic.
+// It returns one page of rooms, most populated first, and the total number of matches.
+func ListPublicRooms(ctx context.Context, query string, page, limit int) ([]models.Room, int64, error) {
+	collection := mongodb.ChatDB.Collection("rooms")
+
+	filter := bson.M{"visibility": models.RoomVisibilityPublic}
+	if query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}
+		filter["$or"] = bson.A{
+			bson.M{"name": pattern},
+			bson.M{"topic": pattern},
+		}
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "member_count", Value: -1}, {Key: "name", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"last_message": 0})
+
+	cur, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	rooms := []models.Room{}
+	if err := cur.All(ctx, &rooms); err != nil {
+		return nil, 0, err
+	}
+	return rooms, total, nil
+}
+
+// GetConversations lists the user's archived or active rooms. Favorites come
+// first, then rooms with a manual position, then the rest by recent activity.
+func GetConversations(ctx context.Context, userID int, archived bool) ([]models.Conversation, error) {
+	members := mongodb.ChatDB.Collection("room_members")
+	rooms := mongodb.ChatDB.Collection("rooms")
+
+	filter := bson.M{"user_id": userID, "archived": bson.M{"$ne": true}}
+	if archived {
+		filter["archived"] = true
+	}
+	cur, err := members.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var memberships []models.RoomMember
+	if err := cur.All(ctx, &memberships); err != nil {
+		return nil, err
+	}
+
+	byRoom := make(map[string]models.RoomMember, len(memberships))
+	roomIDs := make([]string, 0, len(memberships))
+	for _, m := range memberships {
+		byRoom[m.RoomID] = m
+		roomIDs = append(roomIDs, m.RoomID)
+	}
+	if len(roomIDs) == 0 {
+		return []models.Conversation{}, nil
+	}
+
+	opts := options.Find().SetSort(bson.D{primitive.E{Key: "last_activity", Value: -1}})
+	roomCur, err := rooms.Find(ctx, bson.M{"_id": bson.M{"$in": roomIDs}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var roomDocs []models.Room
+	if err := roomCur.All(ctx, &roomDocs); err != nil {
+		return nil, err
+	}
+
+	previews, err := visiblePreviews(ctx, userID, roomDocs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	conversations := make([]models.Conversation, 0, len(roomDocs))
+	for _, room := range roomDocs {
+		member := byRoom[room.ID]
+		if preview, ok := previews[room.ID]; ok {
+			room.LastMessage = preview
+		}
+		conv := models.Conversation{
+			RoomID:          room.ID,
+			RoomName:        room.Name,
+			IsGroup:         room.IsGroup,
+			LastMessageTime: room.LastActivity,
+			UnreadCount:     member.UnreadCount,
+			Archived:        member.Archived,
+			Muted:           member.IsMuted(now),
+			Favorite:        member.Favorite,
+			Position:        member.Position,
+		}
+		if conv.Muted {
+			conv.MutedUntil = member.MutedUntil
+		}
+		if participants, ok := PrivateRoomParticipants(room.ID); ok {
+			for _, uid := range participants {
+				if uid != userID {
+					conv.PartnerID = uid
+				}
+			}
+		}
+		if room.LastMessage != nil {
+			conv.LastMessageID = room.LastMessage.MessageID.Hex()
+			conv.LastMessage = room.LastMessage.Content
+			conv.LastMessageSenderID = room.LastMessage.SenderID
+			conv.LastMessageTime = room.LastMessage.Timestamp
+		}
+		conversations = append(conversations, conv)
+	}
+
+	// Rooms are already ordered by activity; a stable sort keeps that order within each group
+	sort.SliceStable(conversations, func(i, j int) bool {
+		a, b := conversations[i], conversations[j]
+		if a.Favorite != b.Favorite {
+			return a.Favorite
+		}
+		if (a.Position > 0) != (b.Position > 0) {
+			return a.Position > 0
+		}
+		return a.Position < b.Position
+	})
+	return conversations, nil
+}
+
+// visiblePreviews finds the rooms whose last message the user deleted for
+// themselves and returns, by room, the preview of the newest message they can
+// still see there, or nil when there is none
+func visiblePreviews(ctx context.Context, userID int, rooms []models.Room) (map[string]*models.MessagePreview, error) {
+	lastIDs := make([]primitive.ObjectID, 0, len(rooms))
+	for _, room := range rooms {
+		if room.LastMessage != nil {
+			lastIDs = append(lastIDs, room.LastMessage.MessageID)
+		}
+	}
+	if len(lastIDs) == 0 {
+		return nil, nil
+	}
+
+	messages := mongodb.ChatDB.Collection("messages")
+	cur, err := messages.Find(ctx,
+		bson.M{"_id": bson.M{"$in": lastIDs}, "hidden_for": userID},
+		options.Find().SetProjection(bson.M{"room_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var hidden []models.Message
+	if err := cur.All(ctx, &hidden); err != nil {
+		return nil, err
+	}
+
+	previews := make(map[string]*models.MessagePreview, len(hidden))
+	for _, msg := range hidden {
+		var latest models.Message
+		err := messages.FindOne(ctx,
+			bson.M{"room_id": msg.RoomID, "deleted": false, "hidden_for": bson.M{"$ne": userID}},
+			options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}),
+		).Decode(&latest)
+		if err == mongo.ErrNoDocuments {
+			previews[msg.RoomID] = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		previews[msg.RoomID] = buildPreview(&latest)
+	}
+	return previews, nil
+}
+
+// UpdateRoomPreferences sets and clears the user's preference fields for a room
+func UpdateRoomPreferences(ctx context.Context, roomID string, userID int, set, unset bson.M) (*models.RoomMember, error) {
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var member models.RoomMember
+	err := mongodb.ChatDB.Collection("room_members").FindOneAndUpdate(ctx,
+		bson.M{"room_id": roomID, "user_id": userID},
+		update,
+		opts,
+	).Decode(&member)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetNotificationRecipients returns the members of a room, other than the
+// sender, who should be notified about a new message
+func GetNotificationRecipients(ctx context.Context, roomID string, senderID int) ([]int, error) {
+	filter := bson.M{
+		"room_id": roomID,
+		"user_id": bson.M{"$ne": senderID},
+		"$or": bson.A{
+			bson.M{"muted_until": bson.M{"$exists": false}},
+			bson.M{"muted_until": bson.M{"$lte": time.Now().Unix()}},
+		},
+	}
+	opts := options.Find().SetProjection(bson.M{"user_id": 1})
+
+	cur, err := mongodb.ChatDB.Collection("room_members").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var members []models.RoomMember
+	if err := cur.All(ctx, &members); err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]int, 0, len(members))
+	for _, m := range members {
+		userIDs = append(userIDs, m.UserID)
+	}
+	return userIDs, nil
+}
+
+// MarkRoomRead advances the user's read position in a room and recomputes their unread count.
+// A nil messageID marks the whole room as read.
+func MarkRoomRead(ctx context.Context, roomID string, userID int, messageID *primitive.ObjectID) (*models.RoomMember, error) {
+	members := mongodb.ChatDB.Collection("room_members")
+
+	if messageID == nil {
+		var room models.Room
+		if err := mongodb.ChatDB.Collection("rooms").FindOne(ctx, bson.M{"_id": roomID}).Decode(&room); err != nil {
+			return nil, err
+		}
+		if room.LastMessage == nil {
+			return nil, mongo.ErrNoDocuments
+		}
+		messageID = &room.LastMessage.MessageID
+	} else {
+		err := mongodb.ChatDB.Collection("messages").FindOne(ctx,
+			bson.M{"_id": *messageID, "room_id": roomID},
+			options.FindOne().SetProjection(bson.M{"_id": 1}),
+		).Err()
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrReadMessageNotInRoom
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	unread, err := mongodb.ChatDB.Collection("messages").CountDocuments(ctx, unreadFilter(roomID, userID, *messageID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Only move the read position forward
+	filter := bson.M{
+		"room_id": roomID,
+		"user_id": userID,
+		"$or": bson.A{
+			bson.M{"last_read_message_id": bson.M{"$exists": false}},
+			bson.M{"last_read_message_id": bson.M{"$lt": *messageID}},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"last_read_message_id": *messageID,
+		"last_read_at":         time.Now().Unix(),
+		"unread_count":         unread,
+	}}
+	result, err := members.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.ModifiedCount > 0 {
+		if err := recordRead(ctx, roomID, userID, *messageID); err != nil {
+			return nil, err
+		}
+		if err := markMentionsRead(ctx, roomID, userID, *messageID); err != nil {
+			return nil, err
+		}
+	}
+
+	var member models.RoomMember
+	if err := members.FindOne(ctx, bson.M{"room_id": roomID, "user_id": userID}).Decode(&member); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
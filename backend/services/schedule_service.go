@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxScheduleAhead is how far in the future a message can be scheduled
+const MaxScheduleAhead = 365 * 24 * time.Hour
+
+var (
+	// ErrSendAtInPast is returned when a scheduled message's send time has already passed
+	ErrSendAtInPast = errors.New("send_at must be in the future")
+	// ErrSendAtTooFar is returned when a message is scheduled beyond MaxScheduleAhead
+	ErrSendAtTooFar = errors.New("send_at must be within a year")
+	// ErrScheduledNotPending is returned when changing a scheduled message that was already sent or cancelled
+	ErrScheduledNotPending = errors.New("scheduled message is no longer pending")
+)
+
+// ValidateSendAt checks that a send time is in the future and within MaxScheduleAhead
+func ValidateSendAt(sendAt int64) error {
+	now := time.Now()
+	if sendAt <= now.Unix() {
+		return ErrSendAtInPast
+	}
+	if sendAt > now.Add(MaxScheduleAhead).Unix() {
+		return ErrSendAtTooFar
+	}
+	return nil
+}
+
+// CreateScheduledMessage stores a message to be sent at sm.SendAt
+func CreateScheduledMessage(ctx context.Context, sm *models.ScheduledMessage) error {
+	if err := ValidateSendAt(sm.SendAt); err != nil {
+		return err
+	}
+
+	isGroup, err := roomIsGroup(ctx, sm.RoomID)
+	if err != nil {
+		return err
+	}
+	sm.IsGroup = isGroup
+
+	now := time.Now().Unix()
+	sm.ID = primitive.NewObjectID()
+	sm.Status = models.ScheduledStatusPending
+	sm.CreatedAt = now
+	sm.UpdatedAt = now
+	_, err = mongodb.ChatDB.Collection("scheduled_messages").InsertOne(ctx, sm)
+	return err
+}
+
+// GetScheduledMessage loads a scheduled message by ID
+func GetScheduledMessage(ctx context.Context, id primitive.ObjectID) (*models.ScheduledMessage, error) {
+	var sm models.ScheduledMessage
+	err := mongodb.ChatDB.Collection("scheduled_messages").FindOne(ctx, bson.M{"_id": id}).Decode(&sm)
+	if err != nil {
+		return nil, err
+	}
+	return &sm, nil
+}
+
+// ListScheduledMessages returns the sender's pending scheduled messages,
+// soonest first, optionally limited to one room
+func ListScheduledMessages(ctx context.Context, senderID int, roomID string) ([]models.ScheduledMessage, error) {
+	filter := bson.M{"sender_id": senderID, "status": models.ScheduledStatusPending}
+	if roomID != "" {
+		filter["room_id"] = roomID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "send_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	cur, err := mongodb.ChatDB.Collection("scheduled_messages").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	scheduled := []models.ScheduledMessage{}
+	if err := cur.All(ctx, &scheduled); err != nil {
+		return nil, err
+	}
+	return scheduled, nil
+}
+
+// UpdateScheduledMessage applies changes to a pending scheduled message owned by senderID
+func UpdateScheduledMessage(ctx context.Context, id primitive.ObjectID, senderID int, changes bson.M) (*models.ScheduledMessage, error) {
+	changes["updated_at"] = time.Now().Unix()
+	return changePendingScheduledMessage(ctx, id, senderID, bson.M{"$set": changes})
+}
+
+// CancelScheduledMessage stops a pending scheduled message from being sent
+func CancelScheduledMessage(ctx context.Context, id primitive.ObjectID, senderID int) (*models.ScheduledMessage, error) {
+	return changePendingScheduledMessage(ctx, id, senderID, bson.M{"$set": bson.M{
+		"status":     models.ScheduledStatusCancelled,
+		"updated_at": time.Now().Unix(),
+	}})
+}
+
+// changePendingScheduledMessage updates a scheduled message only while it is
+// still pending, so a dispatcher that already claimed it always wins
+func changePendingScheduledMessage(ctx context.Context, id primitive.ObjectID, senderID int, update bson.M) (*models.ScheduledMessage, error) {
+	collection := mongodb.ChatDB.Collection("scheduled_messages")
+	filter := bson.M{"_id": id, "sender_id": senderID, "status": models.ScheduledStatusPending}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var sm models.ScheduledMessage
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&sm)
+	if err == nil {
+		return &sm, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	// Work out why the update did not match
+	if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&sm); err != nil {
+		return nil, err
+	}
+	if sm.SenderID != senderID {
+		return nil, ErrNotMessageSender
+	}
+	return nil, ErrScheduledNotPending
+}
+
+// ClaimDueScheduledMessage atomically claims the oldest scheduled message that
+// is due, for owner and for the length of lease. Messages whose previous claim
+// expired without being sent are claimed again. It returns nil when nothing is due.
+func ClaimDueScheduledMessage(ctx context.Context, owner string, lease time.Duration) (*models.ScheduledMessage, error) {
+	now := time.Now()
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": models.ScheduledStatusPending, "send_at": bson.M{"$lte": now.Unix()}},
+		bson.M{"status": models.ScheduledStatusSending, "claimed_until": bson.M{"$lt": now.Unix()}},
+	}}
+	// The message ID is reserved on the first claim and kept on later ones,
+	// so a message stored before a crash is recognised instead of stored again
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"status":        models.ScheduledStatusSending,
+		"claimed_by":    owner,
+		"claimed_until": now.Add(lease).Unix(),
+		"message_id":    bson.M{"$ifNull": bson.A{"$message_id", primitive.NewObjectID()}},
+		"updated_at":    now.Unix(),
+	}}}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "send_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var sm models.ScheduledMessage
+	err := mongodb.ChatDB.Collection("scheduled_messages").FindOneAndUpdate(ctx, filter, update, opts).Decode(&sm)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sm, nil
+}
+
+// DeliverScheduledMessage stores a claimed scheduled message as a regular
+// message. It returns the stored message for broadcasting, or nil when there
+// is nothing new to broadcast: the message was stored by an earlier attempt,
+// was rejected, or was pushed back by the room's slow mode.
+func DeliverScheduledMessage(ctx context.Context, sm *models.ScheduledMessage, owner string) (*models.Message, error) {
+	// An earlier claim may have stored the message and stopped before recording it
+	if _, err := GetMessageByID(ctx, *sm.MessageID); err == nil {
+		return nil, finishScheduledMessage(ctx, sm, owner, models.ScheduledStatusSent, "")
+	} else if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	allowed, err := CanPostToRoom(ctx, sm.RoomID, sm.SenderID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, finishScheduledMessage(ctx, sm, owner, models.ScheduledStatusFailed, "You are not a member of this room")
+	}
+
+	if err := EnforcePostingPolicy(ctx, sm.RoomID, sm.SenderID, sm.AttachmentURL != ""); err != nil {
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) {
+			return nil, err
+		}
+		if policyErr.Code == PolicySlowMode {
+			return nil, rescheduleMessage(ctx, sm, owner, time.Now().Unix()+policyErr.RetryAfter)
+		}
+		return nil, finishScheduledMessage(ctx, sm, owner, models.ScheduledStatusFailed, policyErr.Message)
+	}
+
+	msg := models.Message{
+		ID:             *sm.MessageID,
+		RoomID:         sm.RoomID,
+		SenderID:       sm.SenderID,
+		Message:        sm.Message,
+		IsGroup:        sm.IsGroup,
+		Status:         models.MessageStatusSent,
+		AttachmentURL:  sm.AttachmentURL,
+		AttachmentType: sm.AttachmentType,
+		ReplyToID:      sm.ReplyToID,
+		Deleted:        false,
+	}
+	err = InsertMessage(ctx, &msg)
+	if err != nil {
+		ReleasePostingSlot(sm.RoomID, sm.SenderID)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, finishScheduledMessage(ctx, sm, owner, models.ScheduledStatusSent, "")
+	}
+	// Limits may have been lowered since the message was scheduled
+	var contentErr *ContentError
+	if err == ErrInvalidReplyParent || errors.As(err, &contentErr) {
+		return nil, finishScheduledMessage(ctx, sm, owner, models.ScheduledStatusFailed, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := finishScheduledMessage(ctx, sm, owner, models.ScheduledStatusSent, ""); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// finishScheduledMessage records the outcome of a claim held by owner
+func finishScheduledMessage(ctx context.Context, sm *models.ScheduledMessage, owner, status, reason string) error {
+	set := bson.M{"status": status, "updated_at": time.Now().Unix()}
+	if reason != "" {
+		set["error"] = reason
+	}
+	_, err := mongodb.ChatDB.Collection("scheduled_messages").UpdateOne(ctx,
+		bson.M{"_id": sm.ID, "claimed_by": owner},
+		bson.M{"$set": set, "$unset": bson.M{"claimed_by": "", "claimed_until": ""}},
+	)
+	return err
+}
+
+// rescheduleMessage releases a claim and puts the message back in the queue at sendAt
+func rescheduleMessage(ctx context.Context, sm *models.ScheduledMessage, owner string, sendAt int64) error {
+	_, err := mongodb.ChatDB.Collection("scheduled_messages").UpdateOne(ctx,
+		bson.M{"_id": sm.ID, "claimed_by": owner},
+		bson.M{
+			"$set":   bson.M{"status": models.ScheduledStatusPending, "send_at": sendAt, "updated_at": time.Now().Unix()},
+			"$unset": bson.M{"claimed_by": "", "claimed_until": ""},
+		},
+	)
+	return err
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// snippetRadius is how many characters of context are kept around the first match
+const snippetRadius = 60
+
+// SearchQuery filters a full-text message search
+type SearchQuery struct {
+	Text          string
+	RoomID        string
+	SenderID      int
+	From          int64 // unix timestamp, 0 for no lower bound
+	To            int64 // unix timestamp, 0 for no upper bound
+	HasAttachment bool
+	Page          int
+	Limit         int
+}
+
+// ParseSearchText splits search operators such as has:attachment out of the
+// free text. It returns the remaining text and whether has:attachment was given.
+func ParseSearchText(raw string) (string, bool) {
+	var terms []string
+	hasAttachment := false
+	for _, field := range strings.Fields(raw) {
+		if strings.EqualFold(field, "has:attachment") {
+			hasAttachment = true
+			continue
+		}
+		terms = append(terms, field)
+	}
+	return strings.Join(terms, " "), hasAttachment
+}
+
+// SearchMessages runs a full-text search over the messages of rooms the user
+// belongs to. Deleted messages are never returned.
+func SearchMessages(ctx context.Context, userID int, query SearchQuery) ([]models.SearchResult, int64, error) {
+	roomIDs, err := GetUserRoomIDs(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if query.RoomID != "" {
+		allowed := false
+		for _, id := range roomIDs {
+			if id == query.RoomID {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return []models.SearchResult{}, 0, nil
+		}
+		roomIDs = []string{query.RoomID}
+	}
+	if len(roomIDs) == 0 {
+		return []models.SearchResult{}, 0, nil
+	}
+
+	filter := bson.M{
+		"$text":      bson.M{"$search": query.Text},
+		"room_id":    bson.M{"$in": roomIDs},
+		"deleted":    false,
+		"hidden_for": bson.M{"$ne": userID},
+	}
+	if query.SenderID > 0 {
+		filter["sender_id"] = query.SenderID
+	}
+	if query.From > 0 || query.To > 0 {
+		timeRange := bson.M{}
+		if query.From > 0 {
+			timeRange["$gte"] = query.From
+		}
+		if query.To > 0 {
+			timeRange["$lte"] = query.To
+		}
+		filter["timestamp"] = timeRange
+	}
+	if query.HasAttachment {
+		filter["attachment_url"] = bson.M{"$exists": true, "$ne": ""}
+	}
+
+	collection := mongodb.ChatDB.Collection("messages")
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "timestamp", Value: -1}}).
+		SetSkip(int64((query.Page - 1) * query.Limit)).
+		SetLimit(int64(query.Limit))
+
+	cur, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cur.Close(ctx)
+
+	terms := searchTerms(query.Text)
+	results := []models.SearchResult{}
+	for cur.Next(ctx) {
+		var hit struct {
+			models.Message `bson:",inline"`
+			Score          float64 `bson:"score"`
+		}
+		if err := cur.Decode(&hit); err != nil {
+			return nil, 0, err
+		}
+		snippet, highlights := buildSnippet(hit.Message.Message, terms)
+		results = append(results, models.SearchResult{
+			Message:    hit.Message,
+			Snippet:    snippet,
+			Highlights: highlights,
+			Score:      hit.Score,
+		})
+	}
+	return results, total, cur.Err()
+}
+
+// GetUserRoomIDs returns the IDs of every room the user is a member of
+func GetUserRoomIDs(ctx context.Context, userID int) ([]string, error) {
+	opts := options.Find().SetProjection(bson.M{"room_id": 1})
+	cur, err := mongodb.ChatDB.Collection("room_members").Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var members []models.RoomMember
+	if err := cur.All(ctx, &members); err != nil {
+		return nil, err
+	}
+
+	roomIDs := make([]string, 0, len(members))
+	for _, m := range members {
+		roomIDs = append(roomIDs, m.RoomID)
+	}
+	return roomIDs, nil
+}
+
+// searchTerms lowercases the words of a text query, dropping negated words and quotes
+func searchTerms(text string) []string {
+	var terms []string
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		field = strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		if field != "" {
+			terms = append(terms, field)
+		}
+	}
+	return terms
+}
+
+// buildSnippet cuts the content down to the text around the first matching
+// term and returns the [start, end) rune offsets of every term inside it
+func buildSnippet(content string, terms []string) (string, [][2]int) {
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+
+	first := -1
+	for _, term := range terms {
+		if i := runeIndex(lower, []rune(term), 0); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+
+	start, end := 0, len(runes)
+	if first >= 0 {
+		if first > snippetRadius {
+			start = first - snippetRadius
+		}
+		if first+snippetRadius*2 < end {
+			end = first + snippetRadius*2
+		}
+	} else if end > snippetRadius*2 {
+		end = snippetRadius * 2
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "…"
+	}
+	if end < len(runes) {
+		suffix = "…"
+	}
+	offset := len([]rune(prefix))
+
+	highlights := [][2]int{}
+	window := lower[start:end]
+	for _, term := range terms {
+		termRunes := []rune(term)
+		for i := runeIndex(window, termRunes, 0); i >= 0; i = runeIndex(window, termRunes, i+len(termRunes)) {
+			highlights = append(highlights, [2]int{offset + i, offset + i + len(termRunes)})
+		}
+	}
+	return prefix + string(runes[start:end]) + suffix, highlights
+}
+
+// runeIndex finds needle in haystack starting at from, or returns -1
+func runeIndex(haystack, needle []rune, from int) int {
+	if len(needle) == 0 {
+		return -1
+	}
+	for i := from; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j := range needle {
+			if haystack[i+j] != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StarMessage bookmarks a message for the user. Starring a message twice
+// keeps the first star; the bool reports whether a new star was created.
+func StarMessage(ctx context.Context, userID int, msg *models.Message) (*models.Star, bool, error) {
+	star := models.Star{
+		UserID:    userID,
+		MessageID: msg.ID,
+		RoomID:    msg.RoomID,
+		StarredAt: time.Now().Unix(),
+	}
+	result, err := mongodb.ChatDB.Collection("stars").UpdateOne(ctx,
+		bson.M{"user_id": userID, "message_id": msg.ID},
+		bson.M{"$setOnInsert": star},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	if result.UpsertedCount > 0 {
+		return &star, true, nil
+	}
+
+	var existing models.Star
+	err = mongodb.ChatDB.Collection("stars").FindOne(ctx, bson.M{"user_id": userID, "message_id": msg.ID}).Decode(&existing)
+	if err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+// UnstarMessage removes the user's star from a message and returns it. It
+// returns mongo.ErrNoDocuments when the message was not starred.
+func UnstarMessage(ctx context.Context, userID int, messageID primitive.ObjectID) (*models.Star, error) {
+	var star models.Star
+	err := mongodb.ChatDB.Collection("stars").FindOneAndDelete(ctx, bson.M{"user_id": userID, "message_id": messageID}).Decode(&star)
+	if err != nil {
+		return nil, err
+	}
+	return &star, nil
+}
+
+// GetStarredMessages returns one page of the user's starred messages across
+// rooms, most recently starred first, and the total number of stars shown.
+// Stars on deleted messages, messages the user hid and rooms the user can no
+// longer read are left out.
+func GetStarredMessages(ctx context.Context, userID int, page, limit int) ([]models.StarredMessage, int64, error) {
+	roomIDs, err := GetUserRoomIDs(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "messages",
+			"localField":   "message_id",
+			"foreignField": "_id",
+			"as":           "message",
+		}}},
+		{{Key: "$unwind", Value: "$message"}},
+		{{Key: "$match", Value: bson.M{
+			"message.deleted":    false,
+			"message.hidden_for": bson.M{"$ne": userID},
+		}}},
+		// Public rooms stay readable without membership
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "rooms",
+			"localField":   "room_id",
+			"foreignField": "_id",
+			"as":           "room",
+		}}},
+		{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"room_id": bson.M{"$in": roomIDs}},
+			bson.M{"room.visibility": models.RoomVisibilityPublic},
+		}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "starred_at", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$facet", Value: bson.M{
+			"items": bson.A{
+				bson.M{"$skip": int64((page - 1) * limit)},
+				bson.M{"$limit": int64(limit)},
+				bson.M{"$project": bson.M{"message": 1, "starred_at": 1}},
+			},
+			"total": bson.A{bson.M{"$count": "count"}},
+		}}},
+	}
+
+	cur, err := mongodb.ChatDB.Collection("stars").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	var facets []struct {
+		Items []models.StarredMessage `bson:"items"`
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+	}
+	if err := cur.All(ctx, &facets); err != nil {
+		return nil, 0, err
+	}
+
+	starred := []models.StarredMessage{}
+	var total int64
+	if len(facets) > 0 {
+		if facets[0].Items != nil {
+			starred = facets[0].Items
+		}
+		if len(facets[0].Total) > 0 {
+			total = facets[0].Total[0].Count
+		}
+	}
+	return starred, total, nil
+}
+
+// StarredMessageIDs returns which of the given messages the user starred
+func StarredMessageIDs(ctx context.Context, userID int, messageIDs []primitive.ObjectID) ([]string, error) {
+	starredIDs := []string{}
+	if len(messageIDs) == 0 {
+		return starredIDs, nil
+	}
+	opts := options.Find().SetProjection(bson.M{"message_id": 1})
+	cur, err := mongodb.ChatDB.Collection("stars").Find(ctx,
+		bson.M{"user_id": userID, "message_id": bson.M{"$in": messageIDs}},
+		opts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var stars []models.Star
+	if err := cur.All(ctx, &stars); err != nil {
+		return nil, err
+	}
+	for _, star := range stars {
+		starredIDs = append(starredIDs, star.MessageID.Hex())
+	}
+	return starredIDs, nil
+}
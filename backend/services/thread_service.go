@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-react-chat/kalpesh-vala/github.com/db/mongodb"
+	"go-react-chat/kalpesh-vala/github.com/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrInvalidReplyParent is returned when a reply points at a message that is missing or in another room
+var ErrInvalidReplyParent = errors.New("reply_to_id must be a message in the same room")
+
+// validateReplyParent checks that a reply's parent exists in the reply's room
+func validateReplyParent(ctx context.Context, reply *models.Message) error {
+	parent, err := GetMessageByID(ctx, *reply.ReplyToID)
+	if err == mongo.ErrNoDocuments {
+		return ErrInvalidReplyParent
+	}
+	if err != nil {
+		return err
+	}
+	if parent.RoomID != reply.RoomID {
+		return ErrInvalidReplyParent
+	}
+	return nil
+}
+
+// recordThreadReply updates the parent message's thread summary after a reply is stored
+func recordThreadReply(ctx context.Context, reply *models.Message) error {
+	_, err := mongodb.ChatDB.Collection("messages").UpdateOne(ctx,
+		bson.M{"_id": *reply.ReplyToID},
+		bson.M{
+			"$inc":      bson.M{"reply_count": 1},
+			"$max":      bson.M{"last_reply_at": reply.Timestamp},
+			"$addToSet": bson.M{"thread_participants": reply.SenderID},
+		},
+	)
+	return err
+}
+
+// GetThreadReplies returns one page of the replies to a message, oldest first
+func GetThreadReplies(ctx context.Context, parent *models.Message, query HistoryQuery) (*models.MessagePage, error) {
+	base := bson.M{"room_id": parent.RoomID, "reply_to_id": parent.ID}
+	return getHistoryPage(ctx, parent.RoomID, base, query)
+}
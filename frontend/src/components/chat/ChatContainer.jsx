@@ -37,7 +37,6 @@ const ChatContainer = ({ selectedRoom, onBackToList }) => {
     connectionError,
     typingUsers,
     sendMessage,
-    sendReaction,
     startTyping,
     stopTyping
   } = useWebSocket(selectedRoom);
@@ -251,22 +251,6 @@ const useWebSocket = (roomId) => {
     }
   }, [roomId, user?.id]);
 
-  const sendReaction = useCallback((reactionData) => {
-    if (ws.current?.readyState === WebSocket.OPEN) {
-      const payload = {
-        type: 'reaction',
-        message_id: reactionData.message_id,
-        room_id: roomId,
-        user_id: user?.id,
-        emoji: reactionData.emoji,
-        action: reactionData.action || 'add'
-      };
-      
-      console.log('Sending reaction:', payload);
-      ws.current.send(JSON.stringify(payload));
-    }
-  }, [roomId, user?.id]);
-
   const startTyping = useCallback(() => {
     if (ws.current?.readyState === WebSocket.OPEN && !isTyping.current) {
       isTyping.current = true;
@@ -311,7 +295,6 @@ const useWebSocket = (roomId) => {
     connectionError,
     typingUsers,
     sendMessage,
-    sendReaction,
     startTyping,
     stopTyping,
     reconnect: connect